@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/topi314/gobin/v3/internal/ver"
+	"github.com/topi314/gobin/v3/server"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// backupDB writes a backup of the database of a config to a zstd compressed tar archive.
+func backupDB(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	cfgPath := flags.String("config", "gobin.toml", "path to gobin.toml")
+	outPath := flags.String("out", "", "path of the backup archive, for example gobin-backup.tar.zst")
+	_ = flags.Parse(args)
+
+	if *outPath == "" {
+		flags.Usage()
+		return fmt.Errorf("--out is required")
+	}
+
+	cfg, err := server.LoadConfig(*cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	setupLogger(cfg.Log)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	db, err := openDB(ctx, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	// write to a temporary file first, so an interrupted backup never replaces an existing one
+	file, err := os.Create(*outPath + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	slog.Info("Backing up database...", slog.String("type", string(cfg.Database.Type)), slog.String("out", *outPath))
+	manifest, err := database.Backup(ctx, db, file, ver.Load().Version)
+	if err != nil {
+		return fmt.Errorf("failed to backup database: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync backup file: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to close backup file: %w", err)
+	}
+	if err = os.Rename(file.Name(), *outPath); err != nil {
+		return fmt.Errorf("failed to rename backup file: %w", err)
+	}
+
+	logManifest(manifest)
+	slog.Info("Database backed up", slog.String("out", *outPath))
+	return nil
+}
+
+// restoreDB restores a backup archive into the empty database of a config.
+func restoreDB(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	cfgPath := flags.String("config", "gobin.toml", "path to gobin.toml")
+	inPath := flags.String("in", "", "path of the backup archive")
+	_ = flags.Parse(args)
+
+	if *inPath == "" {
+		flags.Usage()
+		return fmt.Errorf("--in is required")
+	}
+
+	cfg, err := server.LoadConfig(*cfgPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	setupLogger(cfg.Log)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	file, err := os.Open(*inPath)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	db, err := openDB(ctx, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	slog.Info("Restoring database...", slog.String("type", string(cfg.Database.Type)), slog.String("in", *inPath))
+	manifest, err := database.Restore(ctx, db, file)
+	if err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+
+	logManifest(manifest)
+	slog.Info("Database restored", slog.String("from", string(manifest.DatabaseType)), slog.String("gobin-version", manifest.GobinVersion), slog.Time("created-at", manifest.CreatedAt))
+	return nil
+}
+
+func logManifest(manifest *database.BackupManifest) {
+	for _, table := range manifest.Tables {
+		slog.Info("Table", slog.String("table", table.Table), slog.Int64("rows", table.Rows), slog.String("checksum", fmt.Sprintf("%016x", table.Checksum)))
+	}
+}
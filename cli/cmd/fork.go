@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/internal/cfg"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server"
+)
+
+func NewForkCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "fork",
+		GroupID: "actions",
+		Short:   "Forks a document into a new document",
+		Example: `gobin fork jis74978
+
+Will create a new document with the files of the latest version of jis74978 and save its token.
+
+gobin fork jis74978 1700000000000
+
+Will create a new document with the files of version 1700000000000 of jis74978.`,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("message", cmd.Flags().Lookup("message"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			message := viper.GetString("message")
+
+			path := "/documents/" + documentID
+			if len(args) > 1 {
+				path += "/versions/" + args[1]
+			}
+
+			headers := http.Header{}
+			if message != "" {
+				headers.Set(ezhttp.HeaderMessage, message)
+			}
+
+			rs, err := ezhttp.Post(path+"/fork", ezhttp.NewHeaderReader(strings.NewReader(""), headers))
+			if err != nil {
+				return fmt.Errorf("failed to fork document: %w", err)
+			}
+			defer func() {
+				_ = rs.Body.Close()
+			}()
+
+			var documentRs server.DocumentResponse
+			if err = ezhttp.ProcessBody("fork document", rs, &documentRs); err != nil {
+				return err
+			}
+
+			cmd.Printf("Forked document: %s to ID: %s, Version: %d, URL: %s/%s\n", documentID, documentRs.Key, documentRs.Version, viper.GetString("server"), documentRs.Key)
+
+			path, err = cfg.Update(func(m map[string]string) {
+				m["TOKENS_"+documentRs.Key] = documentRs.Token
+				m["VERSIONS_"+documentRs.Key] = strconv.FormatInt(documentRs.Version, 10)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+			cmd.Println("Saved token to:", path)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("message", "m", "", "The message of the first version of the fork")
+}
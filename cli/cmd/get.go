@@ -3,16 +3,19 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
-	"time"
+	"strconv"
+	"strings"
 
 	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/topi314/chroma/v2/lexers"
 
+	"github.com/topi314/gobin/v3/internal/cfg"
 	"github.com/topi314/gobin/v3/internal/ezhttp"
 	"github.com/topi314/gobin/v3/server"
 )
@@ -40,6 +43,12 @@ Will return the document with the id of jis74978.`,
 			if err := viper.BindPFlag("versions", cmd.Flags().Lookup("versions")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("before", cmd.Flags().Lookup("before")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("limit", cmd.Flags().Lookup("limit")); err != nil {
+				return err
+			}
 			if err := viper.BindPFlag("formatter", cmd.Flags().Lookup("formatter")); err != nil {
 				return err
 			}
@@ -49,6 +58,12 @@ Will return the document with the id of jis74978.`,
 			if err := viper.BindPFlag("style", cmd.Flags().Lookup("style")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("token", cmd.Flags().Lookup("token")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("password", cmd.Flags().Lookup("password")); err != nil {
+				return err
+			}
 			return viper.BindPFlag("output", cmd.Flags().Lookup("output"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -59,13 +74,33 @@ Will return the document with the id of jis74978.`,
 			file := viper.GetString("file")
 			version := viper.GetString("version")
 			versions := viper.GetBool("versions")
+			before := viper.GetString("before")
+			limit := viper.GetInt("limit")
 			formatter := viper.GetString("formatter")
 			language := viper.GetString("language")
 			style := viper.GetString("style")
 			output := viper.GetString("output")
+			// private documents can only be read with a token
+			token := viper.GetString("token")
+			if token == "" {
+				token = viper.GetString("tokens_" + documentID)
+			}
+			password := viper.GetString("password")
 
 			if versions {
-				rs, err := ezhttp.Get("/documents/" + documentID + "/versions")
+				query := make(url.Values)
+				if before != "" {
+					query.Add("before", before)
+				}
+				if limit > 0 {
+					query.Add("limit", strconv.Itoa(limit))
+				}
+				uri := "/documents/" + documentID + "/versions"
+				if len(query) > 0 {
+					uri += "?" + query.Encode()
+				}
+
+				rs, err := getDocument(uri, token, password)
 				if err != nil {
 					return fmt.Errorf("failed to get document versions: %w", err)
 				}
@@ -73,17 +108,23 @@ Will return the document with the id of jis74978.`,
 					_ = rs.Body.Close()
 				}()
 
-				var documentVersionsRs []server.DocumentResponse
+				var documentVersionsRs server.DocumentVersionsResponse
 				if err = ezhttp.ProcessBody("get document versions", rs, &documentVersionsRs); err != nil {
 					return err
 				}
 
 				var documentVersions string
-				for _, documentVersion := range documentVersionsRs {
-					documentVersions += fmt.Sprintf("%d: %s\n", documentVersion.Version, humanize.Time(time.UnixMilli(documentVersion.Version)))
+				for _, documentVersion := range documentVersionsRs.Versions {
+					documentVersions += fmt.Sprintf("%d: %s\n", documentVersion.Version, documentVersion.VersionLabel)
+					for _, versionFile := range documentVersion.Files {
+						documentVersions += fmt.Sprintf("  %s (%s, %s, %d lines)\n", versionFile.Name, versionFile.Language, humanize.Bytes(uint64(versionFile.Size)), versionFile.Lines)
+					}
 				}
 
-				cmd.Printf("Document versions(%d):\n%s", len(documentVersions), documentVersions)
+				cmd.Printf("Document versions(%d):\n%s", len(documentVersionsRs.Versions), documentVersions)
+				if documentVersionsRs.NextBefore != 0 {
+					cmd.Printf("More versions available, use --before %d to get them\n", documentVersionsRs.NextBefore)
+				}
 				return nil
 			}
 
@@ -108,7 +149,7 @@ Will return the document with the id of jis74978.`,
 				uri += "?" + query.Encode()
 			}
 
-			rs, err := ezhttp.Get(uri)
+			rs, err := getDocument(uri, token, password)
 			if err != nil {
 				return fmt.Errorf("failed to get document: %w", err)
 			}
@@ -116,6 +157,15 @@ Will return the document with the id of jis74978.`,
 				_ = rs.Body.Close()
 			}()
 
+			// remember the latest version of own documents so updates can detect concurrent changes
+			if etag := rs.Header.Get(ezhttp.HeaderETag); version == "" && etag != "" && viper.GetString("tokens_"+documentID) != "" {
+				if _, err = cfg.Update(func(m map[string]string) {
+					m["VERSIONS_"+documentID] = strings.Trim(etag, `"`)
+				}); err != nil {
+					return fmt.Errorf("failed to update config: %w", err)
+				}
+			}
+
 			if file != "" {
 				var fileRs server.ResponseFile
 				if err = ezhttp.ProcessBody("get document file", rs, &fileRs); err != nil {
@@ -195,8 +245,12 @@ Will return the document with the id of jis74978.`,
 
 	cmd.Flags().StringP("server", "s", "", "Gobin server address")
 	cmd.Flags().StringP("file", "f", "", "The document file to get")
+	cmd.Flags().StringP("token", "t", "", "The token for a private document")
+	cmd.Flags().StringP("password", "p", "", "The password for a password protected document")
 	cmd.Flags().StringP("version", "v", "", "The version of the document to get")
-	cmd.Flags().BoolP("versions", "", false, "Get all versions of the document")
+	cmd.Flags().BoolP("versions", "", false, "Get the versions of the document from newest to oldest")
+	cmd.Flags().StringP("before", "", "", "Only get versions older than this version (only works in combination with versions)")
+	cmd.Flags().IntP("limit", "", 0, "The maximum number of versions to get (only works in combination with versions)")
 	cmd.Flags().StringP("formatter", "r", "terminal16m", "Format the document with syntax highlighting (terminal8, terminal16, terminal256, terminal16m, html, html-standalone, svg, or none)")
 	cmd.Flags().StringP("language", "l", "", "The language to render the document with (only works in combination with file)")
 	cmd.Flags().StringP("style", "", "", "The style to render the document with")
@@ -214,3 +268,13 @@ Will return the document with the id of jis74978.`,
 		log.Printf("failed to register language flag completion func: %s", err)
 	}
 }
+
+// getDocument gets a resource of a document, the password is only sent if it is set.
+func getDocument(uri string, token string, password string) (*http.Response, error) {
+	if password == "" {
+		return ezhttp.GetToken(uri, token)
+	}
+	return ezhttp.Do(http.MethodGet, uri, token, ezhttp.NewHeaderReader(http.NoBody, http.Header{
+		ezhttp.HeaderPassword: []string{password},
+	}))
+}
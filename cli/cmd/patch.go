@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/internal/cfg"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server"
+)
+
+func NewPatchCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "patch",
+		GroupID: "actions",
+		Short:   "Applies a diff to a document",
+		Example: `gobin patch jis74978 < change.diff
+
+Will apply the unified or git diff from change.diff to the latest version of jis74978 and create a new version.`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("file", cmd.Flags().Lookup("file")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("message", cmd.Flags().Lookup("message")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("base_version", cmd.Flags().Lookup("base-version")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			file := viper.GetString("file")
+			message := viper.GetString("message")
+			baseVersion := viper.GetString("base_version")
+			token := viper.GetString("token")
+
+			if token == "" {
+				token = viper.GetString("tokens_" + documentID)
+			}
+			if token == "" {
+				return fmt.Errorf("no token found or provided for document: %s", documentID)
+			}
+
+			var r io.Reader
+			if file != "" {
+				f, err := os.Open(file)
+				if err != nil {
+					return fmt.Errorf("failed to open diff file: %w", err)
+				}
+				defer func() {
+					_ = f.Close()
+				}()
+				r = f
+			} else {
+				info, err := os.Stdin.Stat()
+				if err != nil {
+					return fmt.Errorf("failed to get stdin info: %w", err)
+				}
+				if info.Mode()&os.ModeCharDevice != 0 {
+					return fmt.Errorf("no diff provided, pipe it to stdin or use --file")
+				}
+				r = os.Stdin
+			}
+
+			headers := http.Header{
+				ezhttp.HeaderContentType: []string{ezhttp.ContentTypeDiff},
+			}
+			if message != "" {
+				headers.Set(ezhttp.HeaderMessage, message)
+			}
+			if baseVersion != "" && baseVersion != "*" {
+				headers.Set(ezhttp.HeaderIfMatch, `"`+baseVersion+`"`)
+			}
+
+			rs, err := ezhttp.PostToken("/documents/"+documentID+"/patch", token, ezhttp.NewHeaderReader(r, headers))
+			if err != nil {
+				return fmt.Errorf("failed to patch document: %w", err)
+			}
+			defer func() {
+				_ = rs.Body.Close()
+			}()
+
+			if rs.StatusCode == http.StatusConflict {
+				var patchErrRs server.PatchErrorResponse
+				if err = json.NewDecoder(rs.Body).Decode(&patchErrRs); err != nil {
+					return fmt.Errorf("failed to decode error response: %w", err)
+				}
+				if len(patchErrRs.Errors) == 0 {
+					return fmt.Errorf("failed to patch document: %s", patchErrRs.Message)
+				}
+				for _, patchErr := range patchErrRs.Errors {
+					if patchErr.Hunk > 0 {
+						cmd.PrintErrf("%s: hunk #%d at line %d: %s\n", patchErr.File, patchErr.Hunk, patchErr.Line, patchErr.Message)
+						continue
+					}
+					cmd.PrintErrf("%s: %s\n", patchErr.File, patchErr.Message)
+				}
+				return fmt.Errorf("failed to patch document: %s", patchErrRs.Message)
+			}
+
+			var documentRs server.DocumentResponse
+			if err = ezhttp.ProcessBody("patch document", rs, &documentRs); err != nil {
+				return err
+			}
+
+			if _, err = cfg.Update(func(m map[string]string) {
+				m["VERSIONS_"+documentID] = strconv.FormatInt(documentRs.Version, 10)
+			}); err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+
+			cmd.Printf("Patched document: %s, new Version: %d\n", documentID, documentRs.Version)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("file", "f", "", "The diff file to apply, defaults to stdin")
+	cmd.Flags().StringP("message", "m", "", "The message describing the changes of this version")
+	cmd.Flags().StringP("base-version", "b", "", "The version the diff is based on, the patch is rejected if the document has been updated since")
+	cmd.Flags().StringP("token", "t", "", "The token for the document")
+
+	if err := cmd.RegisterFlagCompletionFunc("file", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return nil, cobra.ShellCompDirectiveDefault
+	}); err != nil {
+		log.Printf("failed to register file flag completion func: %s", err)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -44,13 +46,29 @@ Will post "hello world!" to the server`,
 			if err := viper.BindPFlag("token", cmd.Flags().Lookup("token")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("base_version", cmd.Flags().Lookup("base-version")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("message", cmd.Flags().Lookup("message")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("visibility", cmd.Flags().Lookup("visibility")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("password", cmd.Flags().Lookup("password")); err != nil {
+				return err
+			}
 			return viper.BindPFlag("languages", cmd.Flags().Lookup("languages"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			files := viper.GetStringSlice("files")
 			documentID := viper.GetString("document")
 			token := viper.GetString("token")
+			baseVersion := viper.GetString("base_version")
+			message := viper.GetString("message")
 			languages := viper.GetStringSlice("languages")
+			visibility := viper.GetString("visibility")
+			password := viper.GetString("password")
 
 			var (
 				readers []io.Reader
@@ -142,6 +160,12 @@ Will post "hello world!" to the server`,
 					}
 				}
 
+				if message != "" {
+					if err := mpw.WriteField("message", message); err != nil {
+						return fmt.Errorf("failed to write message field")
+					}
+				}
+
 				if err := mpw.Close(); err != nil {
 					return fmt.Errorf("failed to close multipart writer")
 				}
@@ -155,7 +179,14 @@ Will post "hello world!" to the server`,
 				err error
 			)
 			if documentID == "" {
-				rs, err = ezhttp.Post("/documents", r)
+				path := "/documents"
+				if visibility != "" {
+					path += "?visibility=" + url.QueryEscape(visibility)
+				}
+				if hr, ok := r.(ezhttp.Reader); ok && password != "" {
+					hr.Headers().Set(ezhttp.HeaderPassword, password)
+				}
+				rs, err = ezhttp.Post(path, r)
 				if err != nil {
 					return fmt.Errorf("failed to create document: %w", err)
 				}
@@ -166,6 +197,16 @@ Will post "hello world!" to the server`,
 				if token == "" {
 					return fmt.Errorf("no token found or provided for document: %s", documentID)
 				}
+				if baseVersion == "" {
+					baseVersion = viper.GetString("versions_" + documentID)
+				}
+				if hr, ok := r.(ezhttp.Reader); ok && baseVersion != "" {
+					ifMatch := baseVersion
+					if ifMatch != "*" {
+						ifMatch = `"` + ifMatch + `"`
+					}
+					hr.Headers().Set(ezhttp.HeaderIfMatch, ifMatch)
+				}
 				rs, err = ezhttp.Patch("/documents/"+documentID, token, r)
 				if err != nil {
 					return fmt.Errorf("failed to update document: %w", err)
@@ -175,6 +216,10 @@ Will post "hello world!" to the server`,
 				_ = rs.Body.Close()
 			}()
 
+			if rs.StatusCode == http.StatusConflict {
+				return fmt.Errorf("document: %s has been updated since version: %s, get the latest version and try again or use --base-version \"*\" to overwrite it", documentID, baseVersion)
+			}
+
 			var documentRs server.DocumentResponse
 			if err = ezhttp.ProcessBody("post document", rs, &documentRs); err != nil {
 				return fmt.Errorf("failed to process response: %w", err)
@@ -186,17 +231,18 @@ Will post "hello world!" to the server`,
 			}
 			cmd.Printf("%s document with ID: %s, Version: %d, URL: %s/%s\n", method, documentRs.Key, documentRs.Version, viper.GetString("server"), documentRs.Key)
 
-			if documentID != "" {
-				return nil
-			}
-
 			path, err := cfg.Update(func(m map[string]string) {
-				m["TOKENS_"+documentRs.Key] = documentRs.Token
+				if documentRs.Token != "" {
+					m["TOKENS_"+documentRs.Key] = documentRs.Token
+				}
+				m["VERSIONS_"+documentRs.Key] = strconv.FormatInt(documentRs.Version, 10)
 			})
 			if err != nil {
 				return fmt.Errorf("failed to update config: %w", err)
 			}
-			cmd.Println("Saved token to:", path)
+			if documentID == "" {
+				cmd.Println("Saved token to:", path)
+			}
 			return nil
 		},
 	}
@@ -207,7 +253,11 @@ Will post "hello world!" to the server`,
 	cmd.Flags().StringSliceP("files", "f", nil, "The files to post")
 	cmd.Flags().StringP("document", "d", "", "The document to update")
 	cmd.Flags().StringP("token", "t", "", "The token for the document to update")
+	cmd.Flags().StringP("base-version", "b", "", "The version the update is based on, defaults to the last version you posted or got (use * to overwrite any version)")
 	cmd.Flags().StringP("languages", "l", "", "The language of the documents")
+	cmd.Flags().StringP("message", "m", "", "The message describing the changes of this version")
+	cmd.Flags().StringP("visibility", "", "", "The visibility of a new document (public or private), private documents can only be read with a token")
+	cmd.Flags().StringP("password", "p", "", "The password of a new document, password protected documents can only be read with the password or a token")
 
 	if err := cmd.RegisterFlagCompletionFunc("files", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return nil, cobra.ShellCompDirectiveDefault
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/internal/cfg"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server"
+)
+
+func NewRevertCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "revert",
+		GroupID: "actions",
+		Short:   "Reverts a document to an earlier version",
+		Example: `gobin revert jis74978 1700000000000
+
+Will create a new version of the document jis74978 with the files of version 1700000000000.`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: documentCompletion,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+				return err
+			}
+			return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			version := args[1]
+			token := viper.GetString("token")
+
+			if _, err := strconv.ParseInt(version, 10, 64); err != nil {
+				return fmt.Errorf("invalid version: %s", version)
+			}
+
+			if token == "" {
+				token = viper.GetString("tokens_" + documentID)
+			}
+			if token == "" {
+				return fmt.Errorf("no token found or provided for document: %s", documentID)
+			}
+
+			rs, err := ezhttp.PostToken("/documents/"+documentID+"/versions/"+version+"/restore", token, nil)
+			if err != nil {
+				return fmt.Errorf("failed to revert document: %w", err)
+			}
+			defer func() {
+				_ = rs.Body.Close()
+			}()
+
+			var documentRs server.DocumentResponse
+			if err = ezhttp.ProcessBody("revert document", rs, &documentRs); err != nil {
+				return err
+			}
+
+			if _, err = cfg.Update(func(m map[string]string) {
+				m["VERSIONS_"+documentID] = strconv.FormatInt(documentRs.Version, 10)
+			}); err != nil {
+				return fmt.Errorf("failed to update config: %w", err)
+			}
+
+			cmd.Printf("Reverted document: %s to version: %s, new Version: %d\n", documentID, version, documentRs.Version)
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.Flags().StringP("server", "s", "", "Gobin server address")
+	cmd.Flags().StringP("token", "t", "", "The token for the document to revert")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,7 +19,11 @@ func NewRmCmd(parent *cobra.Command) {
 		Short:   "Removes a document from the gobin server",
 		Example: `gobin rm jis74978
 
-Will delete the jis74978 from the server.`,
+Will move the jis74978 to the trash of the server, it can be restored until it is purged.
+
+gobin rm --purge jis74978
+
+Will delete the jis74978 from the server immediately.`,
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: documentCompletion,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -28,6 +33,9 @@ Will delete the jis74978 from the server.`,
 			if err := viper.BindPFlag("version", cmd.Flags().Lookup("version")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("purge", cmd.Flags().Lookup("purge")); err != nil {
+				return err
+			}
 			return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -42,6 +50,9 @@ Will delete the jis74978 from the server.`,
 			if version != "" {
 				path += "/versions/" + version
 			}
+			if viper.GetBool("purge") {
+				path += "?purge"
+			}
 
 			if token == "" {
 				token = viper.GetString("tokens_" + documentID)
@@ -63,6 +74,10 @@ Will delete the jis74978 from the server.`,
 				return fmt.Errorf("failed to process response: %w", err)
 			}
 
+			if deleteRs.PurgeAt != nil {
+				cmd.Printf("Moved document: %s to the trash, it is purged at: %s\n", documentID, deleteRs.PurgeAt.Local().Format(time.DateTime))
+				return nil
+			}
 			if version != "" {
 				cmd.Printf("Removed version: %s from document: %s\n", version, documentID)
 			} else {
@@ -75,6 +90,7 @@ Will delete the jis74978 from the server.`,
 
 			path, err = cfg.Update(func(m map[string]string) {
 				delete(m, "TOKENS_"+documentID)
+				delete(m, "VERSIONS_"+documentID)
 			})
 			if err != nil {
 				return fmt.Errorf("failed to update config: %w", err)
@@ -89,4 +105,5 @@ Will delete the jis74978 from the server.`,
 	cmd.Flags().StringP("server", "s", "", "Gobin server address")
 	cmd.Flags().StringP("version", "v", "", "The version to update")
 	cmd.Flags().StringP("token", "t", "", "The token for the document to update")
+	cmd.Flags().BoolP("purge", "p", false, "Delete the document immediately instead of moving it to the trash")
 }
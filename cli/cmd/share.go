@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"slices"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,7 +22,15 @@ func NewShareCmd(parent *cobra.Command) {
 		Short:   "Shares a document",
 		Example: `gobin share -p write -p delete -p share jis74978
 
-Will create a new share the document jis74978 with the permissions write, delete and share`,
+Will create a new share the document jis74978 with the permissions write, delete and share
+
+gobin share -p write --expires-in 24h jis74978
+
+Will share the document jis74978 with the permission write for 24 hours
+
+gobin share -p read --version deployed --files config.yaml jis74978
+
+Will share the file config.yaml of the version tagged deployed of the document jis74978`,
 		Args:              cobra.ExactArgs(1),
 		ValidArgsFunction: documentCompletion,
 		PreRunE: func(cmd *cobra.Command, args []string) error {
@@ -31,6 +40,15 @@ Will create a new share the document jis74978 with the permissions write, delete
 			if err := viper.BindPFlag("token", cmd.Flags().Lookup("token")); err != nil {
 				return err
 			}
+			if err := viper.BindPFlag("expires_in", cmd.Flags().Lookup("expires-in")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("version", cmd.Flags().Lookup("version")); err != nil {
+				return err
+			}
+			if err := viper.BindPFlag("files", cmd.Flags().Lookup("files")); err != nil {
+				return err
+			}
 			return viper.BindPFlag("permissions", cmd.Flags().Lookup("permissions"))
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -38,6 +56,9 @@ Will create a new share the document jis74978 with the permissions write, delete
 			gobinServer := viper.GetString("server")
 			token := viper.GetString("token")
 			permissions := viper.GetStringSlice("permissions")
+			expiresIn := viper.GetDuration("expires_in")
+			version := viper.GetString("version")
+			files := viper.GetStringSlice("files")
 
 			if len(permissions) == 0 {
 				cmd.Printf("Link: %s/%s\n", gobinServer, documentID)
@@ -61,6 +82,12 @@ Will create a new share the document jis74978 with the permissions write, delete
 
 			shareRq := server.ShareRequest{
 				Permissions: perms,
+				Version:     version,
+				Files:       files,
+			}
+			if expiresIn > 0 {
+				expiresInStr := expiresIn.String()
+				shareRq.ExpiresIn = &expiresInStr
 			}
 
 			buff := new(bytes.Buffer)
@@ -79,6 +106,9 @@ Will create a new share the document jis74978 with the permissions write, delete
 			}
 
 			cmd.Printf("Link: %s/%s?token=%s\n", gobinServer, documentID, shareRs.Token)
+			if shareRs.ExpiresAt != nil {
+				cmd.Printf("Expires at: %s\n", shareRs.ExpiresAt.Local().Format(time.DateTime))
+			}
 			return nil
 		},
 	}
@@ -88,6 +118,9 @@ Will create a new share the document jis74978 with the permissions write, delete
 	cmd.Flags().StringP("server", "s", "", "Gobin server address")
 	cmd.Flags().StringP("token", "t", "", "The token for the document")
 	cmd.Flags().StringSliceP("permissions", "p", nil, "The permissions for the document")
+	cmd.Flags().DurationP("expires-in", "e", 0, "How long the share token is valid, never expires if not set")
+	cmd.Flags().StringP("version", "v", "", "Restrict the token to a version or tag of the document (only works with the read permission)")
+	cmd.Flags().StringSliceP("files", "f", nil, "Restrict the token to files of the document (only works with the read permission)")
 
 	if err := cmd.RegisterFlagCompletionFunc("permissions", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return server.AllStringPermissions, cobra.ShellCompDirectiveNoFileComp
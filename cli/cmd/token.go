@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/server"
+)
+
+func NewTokenCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:     "token",
+		GroupID: "actions",
+		Short:   "Manages the tokens of a document",
+	}
+
+	parent.AddCommand(cmd)
+
+	cmd.PersistentFlags().StringP("server", "s", "", "Gobin server address")
+	cmd.PersistentFlags().StringP("token", "t", "", "The token for the document, requires the share permission")
+
+	newTokenListCmd(cmd)
+	newTokenRevokeCmd(cmd)
+}
+
+func newTokenListCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lists the tokens of a document",
+		Example: `gobin token list jis74978
+
+Will list all tokens which have been issued for the document jis74978`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: documentCompletion,
+		PreRunE:           bindTokenFlags,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			token, err := documentToken(documentID)
+			if err != nil {
+				return err
+			}
+
+			rs, err := ezhttp.Do(http.MethodGet, "/documents/"+documentID+"/tokens", token, nil)
+			if err != nil {
+				return fmt.Errorf("failed to list tokens: %w", err)
+			}
+
+			var tokensRs []server.TokenResponse
+			if err = ezhttp.ProcessBody("list tokens", rs, &tokensRs); err != nil {
+				return err
+			}
+
+			for _, t := range tokensRs {
+				issuer := "-"
+				if t.IssuerID != nil {
+					issuer = *t.IssuerID
+				}
+				status := "active"
+				if t.RevokedAt != nil {
+					status = "revoked at " + t.RevokedAt.Local().Format(time.DateTime)
+				}
+				scope := "-"
+				var scopes []string
+				if t.ScopeVersion != nil {
+					scopes = append(scopes, "version "+strconv.FormatInt(*t.ScopeVersion, 10))
+				}
+				if len(t.ScopeFiles) > 0 {
+					scopes = append(scopes, "files "+strings.Join(t.ScopeFiles, ","))
+				}
+				if len(scopes) > 0 {
+					scope = strings.Join(scopes, " ")
+				}
+				cmd.Printf("%s\tcreated: %s\tissuer: %s\tpermissions: %s\tscope: %s\t%s\n", t.ID, t.CreatedAt.Local().Format(time.DateTime), issuer, strings.Join(t.Permissions, ","), scope, status)
+			}
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+}
+
+func newTokenRevokeCmd(parent *cobra.Command) {
+	cmd := &cobra.Command{
+		Use:   "revoke",
+		Short: "Revokes a token of a document",
+		Example: `gobin token revoke jis74978 Q2V7N4RZ5JXKZ6XWQ3YH4PLM
+
+Will revoke the token Q2V7N4RZ5JXKZ6XWQ3YH4PLM of the document jis74978 and all tokens which have been shared with it`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: documentCompletion,
+		PreRunE:           bindTokenFlags,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			documentID := args[0]
+			tokenID := args[1]
+			token, err := documentToken(documentID)
+			if err != nil {
+				return err
+			}
+
+			rs, err := ezhttp.Delete("/documents/"+documentID+"/tokens/"+tokenID, token)
+			if err != nil {
+				return fmt.Errorf("failed to revoke token: %w", err)
+			}
+
+			var revokeRs server.RevokeTokenResponse
+			if err = ezhttp.ProcessBody("revoke token", rs, &revokeRs); err != nil {
+				return err
+			}
+
+			for _, id := range revokeRs.Revoked {
+				cmd.Printf("Revoked token: %s\n", id)
+			}
+			return nil
+		},
+	}
+
+	parent.AddCommand(cmd)
+}
+
+func bindTokenFlags(cmd *cobra.Command, _ []string) error {
+	if err := viper.BindPFlag("server", cmd.Flags().Lookup("server")); err != nil {
+		return err
+	}
+	return viper.BindPFlag("token", cmd.Flags().Lookup("token"))
+}
+
+func documentToken(documentID string) (string, error) {
+	token := viper.GetString("token")
+	if token == "" {
+		token = viper.GetString("tokens_" + documentID)
+	}
+	if token == "" {
+		return "", fmt.Errorf("no token found or provided for document: %s", documentID)
+	}
+	return token, nil
+}
@@ -12,8 +12,12 @@ func main() {
 	cmd.NewGetCmd(rootCmd)
 	cmd.NewPostCmd(rootCmd)
 	cmd.NewRmCmd(rootCmd)
+	cmd.NewRevertCmd(rootCmd)
+	cmd.NewForkCmd(rootCmd)
+	cmd.NewPatchCmd(rootCmd)
 	cmd.NewImportCmd(rootCmd)
 	cmd.NewShareCmd(rootCmd)
+	cmd.NewTokenCmd(rootCmd)
 	cmd.NewVersionCmd(rootCmd, version)
 	cmd.NewEnvCmd(rootCmd)
 	cmd.NewCompletionCmd(rootCmd)
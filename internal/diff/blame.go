@@ -0,0 +1,33 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Blame returns for every line of the last text the index of the text in which the line was last changed.
+// The texts have to be ordered from oldest to newest, an empty text can be used for revisions in which the content did not exist.
+// A missing newline at the end of the text is not counted as change of the last line.
+func Blame(texts []string) []int {
+	var (
+		lines  []string
+		blames []int
+	)
+	for i, text := range texts {
+		newLines := Lines(text)
+		for j, line := range newLines {
+			newLines[j] = strings.TrimSuffix(line, "\n")
+		}
+		newBlames := make([]int, len(newLines))
+		for _, e := range Compute(lines, newLines) {
+			switch e.Kind {
+			case Equal:
+				newBlames[e.B] = blames[e.A]
+			case Insert:
+				newBlames[e.B] = i
+			}
+		}
+		lines = newLines
+		blames = newBlames
+	}
+	return blames
+}
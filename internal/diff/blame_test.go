@@ -0,0 +1,63 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	tests := []struct {
+		name  string
+		texts []string
+		want  []int
+	}{
+		{
+			name:  "single version",
+			texts: []string{"a\nb\n"},
+			want:  []int{0, 0},
+		},
+		{
+			name: "deleted and re-added",
+			texts: []string{
+				"a\nb\nc\n",
+				"a\nx\nc\n",
+				"a\nc\n",
+				"a\nb\nc\nd",
+				"a\nb\nc\nd\n",
+			},
+			// the re-added line is attributed to the version which added it again, the added newline is no change
+			want: []int{0, 3, 0, 3},
+		},
+		{
+			name: "moved lines",
+			texts: []string{
+				"a\nb\nc\n",
+				"a\nb\nc\nd\n",
+				"d\na\nb\nc\n",
+			},
+			want: []int{2, 0, 0, 0},
+		},
+		{
+			name: "file removed and added again",
+			texts: []string{
+				"a\nb\n",
+				"",
+				"a\nb\n",
+				"a\nb\nc\n",
+			},
+			want: []int{2, 2, 3},
+		},
+		{
+			name:  "empty last version",
+			texts: []string{"a\n", "a\nb\n", ""},
+			want:  []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Blame(tt.texts); !slices.Equal(got, tt.want) {
+				t.Errorf("Blame() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
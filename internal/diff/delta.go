@@ -0,0 +1,102 @@
+package diff
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDelta = errors.New("invalid delta")
+
+// Delta returns a line based delta which transforms base into target.
+// It consists of copy instructions "=<line>,<count>\n" which copy count lines of base starting at the 0-based line
+// and insert instructions "+<length>\n<text>" which insert length bytes of text.
+func Delta(base string, target string) string {
+	a, b := Lines(base), Lines(target)
+
+	var (
+		delta     strings.Builder
+		insert    strings.Builder
+		copyStart int
+		copyCount int
+	)
+	flushCopy := func() {
+		if copyCount == 0 {
+			return
+		}
+		delta.WriteString("=" + strconv.Itoa(copyStart) + "," + strconv.Itoa(copyCount) + "\n")
+		copyCount = 0
+	}
+	flushInsert := func() {
+		if insert.Len() == 0 {
+			return
+		}
+		delta.WriteString("+" + strconv.Itoa(insert.Len()) + "\n")
+		delta.WriteString(insert.String())
+		insert.Reset()
+	}
+
+	for _, e := range Compute(a, b) {
+		switch e.Kind {
+		case Equal:
+			flushInsert()
+			if copyCount > 0 && copyStart+copyCount == e.A {
+				copyCount++
+				continue
+			}
+			flushCopy()
+			copyStart, copyCount = e.A, 1
+		case Insert:
+			flushCopy()
+			insert.WriteString(b[e.B])
+		}
+	}
+	flushCopy()
+	flushInsert()
+
+	return delta.String()
+}
+
+// ApplyDelta applies a delta created by Delta to base and returns the target.
+func ApplyDelta(base string, delta string) (string, error) {
+	lines := Lines(base)
+
+	var target strings.Builder
+	for delta != "" {
+		instruction, rest, ok := strings.Cut(delta, "\n")
+		if !ok || instruction == "" {
+			return "", ErrInvalidDelta
+		}
+		delta = rest
+
+		switch instruction[0] {
+		case '=':
+			startStr, countStr, ok := strings.Cut(instruction[1:], ",")
+			if !ok {
+				return "", ErrInvalidDelta
+			}
+			start, err := strconv.Atoi(startStr)
+			if err != nil {
+				return "", ErrInvalidDelta
+			}
+			count, err := strconv.Atoi(countStr)
+			if err != nil || start < 0 || count < 0 || start+count > len(lines) {
+				return "", ErrInvalidDelta
+			}
+			for _, line := range lines[start : start+count] {
+				target.WriteString(line)
+			}
+		case '+':
+			length, err := strconv.Atoi(instruction[1:])
+			if err != nil || length < 0 || length > len(delta) {
+				return "", ErrInvalidDelta
+			}
+			target.WriteString(delta[:length])
+			delta = delta[length:]
+		default:
+			return "", ErrInvalidDelta
+		}
+	}
+
+	return target.String(), nil
+}
@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeltaRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		base   string
+		target string
+	}{
+		{name: "both empty", base: "", target: ""},
+		{name: "empty base", base: "", target: "a\nb\n"},
+		{name: "empty target", base: "a\nb\n", target: ""},
+		{name: "identical", base: "a\nb\nc\n", target: "a\nb\nc\n"},
+		{name: "changed line", base: "a\nb\nc\n", target: "a\nx\nc\n"},
+		{name: "no trailing newline", base: "a\nb", target: "a\nb\nc"},
+		{name: "newline removed", base: "a\nb\n", target: "a\nb"},
+		{name: "reordered", base: "1\n2\n3\n4\n", target: "4\n3\n2\n1\n"},
+		{name: "repeated lines", base: "a\na\na\n", target: "a\nb\na\na\na\n"},
+		{name: "insert looks like instruction", base: "a\n", target: "=0,1\n+3\na\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := Delta(tt.base, tt.target)
+			got, err := ApplyDelta(tt.base, delta)
+			if err != nil {
+				t.Fatalf("failed to apply delta %q: %s", delta, err)
+			}
+			if got != tt.target {
+				t.Errorf("ApplyDelta(%q) = %q, want %q", delta, got, tt.target)
+			}
+		})
+	}
+}
+
+func TestDeltaChain(t *testing.T) {
+	// every version is stored as delta against the previous one like the blobs of a file
+	versions := []string{
+		"a\nb\nc\n",
+		"a\nb\nc\nd\n",
+		"x\nb\nc\nd",
+		"x\nc\nd\ne\n",
+		"",
+		"y\n",
+	}
+	deltas := make([]string, len(versions))
+	for i := range versions {
+		var base string
+		if i > 0 {
+			base = versions[i-1]
+		}
+		deltas[i] = Delta(base, versions[i])
+	}
+
+	var content string
+	for i, delta := range deltas {
+		var err error
+		if content, err = ApplyDelta(content, delta); err != nil {
+			t.Fatalf("failed to apply delta %d: %s", i, err)
+		}
+		if content != versions[i] {
+			t.Errorf("version %d = %q, want %q", i, content, versions[i])
+		}
+	}
+}
+
+func TestApplyDeltaInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		delta string
+	}{
+		{name: "unknown instruction", delta: "?0,1\n"},
+		{name: "missing newline", delta: "=0,1"},
+		{name: "empty instruction", delta: "\n"},
+		{name: "copy without count", delta: "=0\n"},
+		{name: "copy out of range", delta: "=1,2\n"},
+		{name: "negative copy", delta: "=-1,1\n"},
+		{name: "insert too long", delta: "+5\nab"},
+		{name: "invalid insert length", delta: "+x\nab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyDelta("a\nb\n", tt.delta); !errors.Is(err, ErrInvalidDelta) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidDelta)
+			}
+		})
+	}
+}
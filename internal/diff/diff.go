@@ -0,0 +1,172 @@
+package diff
+
+import (
+	"strings"
+)
+
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Edit is a single line operation of an edit script.
+// A is the line index in the old text and B the line index in the new text.
+// A is only valid for Equal & Delete, B only for Equal & Insert.
+type Edit struct {
+	Kind Kind
+	A    int
+	B    int
+}
+
+// Lines splits s into lines, each line keeps its trailing newline.
+func Lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Compute returns the shortest edit script to transform a into b using Myers' linear space algorithm.
+func Compute(a []string, b []string) []Edit {
+	ids := make(map[string]int, len(a)+len(b))
+	d := &differ{
+		a:    toIDs(ids, a),
+		b:    toIDs(ids, b),
+		delA: make([]bool, len(a)),
+		insB: make([]bool, len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	edits := make([]Edit, 0, max(len(a), len(b)))
+	var i, j int
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.delA[i]:
+			edits = append(edits, Edit{Kind: Delete, A: i, B: j})
+			i++
+		case j < len(b) && d.insB[j]:
+			edits = append(edits, Edit{Kind: Insert, A: i, B: j})
+			j++
+		default:
+			edits = append(edits, Edit{Kind: Equal, A: i, B: j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+func toIDs(ids map[string]int, lines []string) []int {
+	s := make([]int, len(lines))
+	for i, line := range lines {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		s[i] = id
+	}
+	return s
+}
+
+type differ struct {
+	a    []int
+	b    []int
+	delA []bool
+	insB []bool
+	vf   []int
+	vb   []int
+}
+
+func (d *differ) compare(aLo int, aHi int, bLo int, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			d.insB[i] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.delA[i] = true
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x, bLo, y)
+		d.compare(u, aHi, v, bHi)
+	}
+}
+
+// middleSnake finds the middle snake of the edit graph between a[aLo:aHi] and b[bLo:bHi].
+// It returns the start (x, y) and end (u, v) of the snake.
+func (d *differ) middleSnake(aLo int, aHi int, bLo int, bHi int) (int, int, int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta&1 != 0
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+
+	size := 2*maxD + 3
+	if cap(d.vf) < size {
+		d.vf = make([]int, size)
+		d.vb = make([]int, size)
+	}
+	vf, vb := d.vf[:size], d.vb[:size]
+	vf[off+1] = 0
+	vb[off+1] = 0
+
+	for D := 0; D <= maxD; D++ {
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if odd && k >= delta-(D-1) && k <= delta+(D-1) && x+vb[off+delta-k] >= n {
+				return aLo + x0, bLo + y0, aLo + x, bLo + y
+			}
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[off+k] = x
+			if !odd && k >= delta-D && k <= delta+D && x+vf[off+delta-k] >= n {
+				return aLo + n - x, bLo + m - y, aLo + n - x0, bLo + m - y0
+			}
+		}
+	}
+	// unreachable, the snakes always overlap after maxD steps
+	return aLo, bLo, aHi, bHi
+}
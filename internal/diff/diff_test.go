@@ -0,0 +1,173 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want []string
+	}{
+		{name: "empty", s: "", want: nil},
+		{name: "trailing newline", s: "a\nb\n", want: []string{"a\n", "b\n"}},
+		{name: "no trailing newline", s: "a\nb", want: []string{"a\n", "b"}},
+		{name: "empty lines", s: "\n\n", want: []string{"\n", "\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Lines(tt.s); !slices.Equal(got, tt.want) {
+				t.Errorf("Lines(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name  string
+		a     string
+		b     string
+		edits int
+	}{
+		{name: "both empty", a: "", b: "", edits: 0},
+		{name: "old empty", a: "", b: "a\nb\n", edits: 2},
+		{name: "new empty", a: "a\nb\n", b: "", edits: 2},
+		{name: "identical", a: "a\nb\nc\n", b: "a\nb\nc\n", edits: 0},
+		{name: "no trailing newline", a: "a\nb", b: "a\nb\n", edits: 2},
+		{name: "replace", a: "a\nb\nc\n", b: "a\nx\nc\n", edits: 2},
+		{name: "myers paper", a: "a\nb\nc\na\nb\nb\na\n", b: "c\nb\na\nb\na\nc\n", edits: 5},
+		{name: "reordered", a: "1\n2\n3\n4\n5\n", b: "5\n4\n3\n2\n1\n", edits: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := Lines(tt.a), Lines(tt.b)
+			edits := Compute(a, b)
+
+			var (
+				got     []string
+				changes int
+				i, j    int
+			)
+			for _, e := range edits {
+				switch e.Kind {
+				case Equal:
+					if e.A != i || e.B != j || a[e.A] != b[e.B] {
+						t.Fatalf("invalid equal edit %+v at %d,%d", e, i, j)
+					}
+					got = append(got, a[e.A])
+					i++
+					j++
+				case Delete:
+					if e.A != i {
+						t.Fatalf("invalid delete edit %+v at %d,%d", e, i, j)
+					}
+					changes++
+					i++
+				case Insert:
+					if e.B != j {
+						t.Fatalf("invalid insert edit %+v at %d,%d", e, i, j)
+					}
+					got = append(got, b[e.B])
+					changes++
+					j++
+				}
+			}
+			if i != len(a) || j != len(b) {
+				t.Fatalf("edits end at %d,%d, want %d,%d", i, j, len(a), len(b))
+			}
+			if strings.Join(got, "") != tt.b {
+				t.Errorf("edits produce %q, want %q", strings.Join(got, ""), tt.b)
+			}
+			if changes != tt.edits {
+				t.Errorf("changes = %d, want %d", changes, tt.edits)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name       string
+		oldName    string
+		newName    string
+		oldContent string
+		newContent string
+		want       string
+	}{
+		{
+			name:       "identical",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "a\nb\n",
+			newContent: "a\nb\n",
+			want:       "",
+		},
+		{
+			name:       "both empty",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "",
+			newContent: "",
+			want:       "",
+		},
+		{
+			name:       "new file",
+			oldName:    "",
+			newName:    "a.txt",
+			oldContent: "",
+			newContent: "a\nb\n",
+			want:       "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:       "deleted file",
+			oldName:    "a.txt",
+			newName:    "",
+			oldContent: "a\n",
+			newContent: "",
+			want:       "--- a/a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:       "no trailing newline",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "a\nb",
+			newContent: "a\nc",
+			want:       "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+		{
+			name:       "newline added",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "a",
+			newContent: "a\n",
+			want:       "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+		{
+			name:       "separate hunks",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			newContent: "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n",
+			want:       "--- a/a.txt\n+++ b/a.txt\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+y\n",
+		},
+		{
+			name:       "merged hunks",
+			oldName:    "a.txt",
+			newName:    "a.txt",
+			oldContent: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			newContent: "x\n2\n3\n4\n5\n6\n7\ny\n",
+			want:       "--- a/a.txt\n+++ b/a.txt\n@@ -1,8 +1,8 @@\n-1\n+x\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified(tt.oldName, tt.newName, tt.oldContent, tt.newContent); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
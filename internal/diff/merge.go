@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"slices"
+	"strings"
+)
+
+// Conflict is a region of the base text which was changed differently by both sides of a merge.
+// BaseLine is the 1-based line in the base text where the region starts.
+type Conflict struct {
+	BaseLine int
+	Base     string
+	Ours     string
+	Theirs   string
+}
+
+// change replaces the lines base[start:end] with lines.
+type change struct {
+	start int
+	end   int
+	lines []string
+}
+
+// Merge does a line based three-way merge of the changes from base to ours and from base to theirs.
+// Changes which overlap or touch each other are reported as conflict unless both sides made the same change.
+// The merged content is only complete if no conflicts are returned, conflicting regions keep the base lines.
+func Merge(base string, ours string, theirs string) (string, []Conflict) {
+	baseLines := Lines(base)
+	oursChanges := changes(baseLines, Lines(ours))
+	theirsChanges := changes(baseLines, Lines(theirs))
+
+	var (
+		merged    []string
+		conflicts []Conflict
+		pos       int
+	)
+	for len(oursChanges) > 0 || len(theirsChanges) > 0 {
+		// collect all changes of both sides which overlap with the next change
+		var oursRegion, theirsRegion []change
+		start, end := -1, -1
+		for {
+			if len(oursChanges) > 0 && (start == -1 && (len(theirsChanges) == 0 || oursChanges[0].start <= theirsChanges[0].start) || start != -1 && oursChanges[0].start <= end) {
+				c := oursChanges[0]
+				oursChanges = oursChanges[1:]
+				oursRegion = append(oursRegion, c)
+				start, end = extend(start, end, c)
+				continue
+			}
+			if len(theirsChanges) > 0 && (start == -1 || theirsChanges[0].start <= end) {
+				c := theirsChanges[0]
+				theirsChanges = theirsChanges[1:]
+				theirsRegion = append(theirsRegion, c)
+				start, end = extend(start, end, c)
+				continue
+			}
+			break
+		}
+
+		merged = append(merged, baseLines[pos:start]...)
+		pos = end
+
+		oursLines := apply(baseLines, start, end, oursRegion)
+		theirsLines := apply(baseLines, start, end, theirsRegion)
+		switch {
+		case len(theirsRegion) == 0:
+			merged = append(merged, oursLines...)
+		case len(oursRegion) == 0, slices.Equal(oursLines, theirsLines):
+			merged = append(merged, theirsLines...)
+		default:
+			merged = append(merged, baseLines[start:end]...)
+			conflicts = append(conflicts, Conflict{
+				BaseLine: start + 1,
+				Base:     strings.Join(baseLines[start:end], ""),
+				Ours:     strings.Join(oursLines, ""),
+				Theirs:   strings.Join(theirsLines, ""),
+			})
+		}
+	}
+	merged = append(merged, baseLines[pos:]...)
+
+	return strings.Join(merged, ""), conflicts
+}
+
+func extend(start int, end int, c change) (int, int) {
+	if start == -1 {
+		return c.start, c.end
+	}
+	return min(start, c.start), max(end, c.end)
+}
+
+// changes returns the changed regions of a to get b.
+func changes(a []string, b []string) []change {
+	var (
+		result  []change
+		current *change
+	)
+	for _, e := range Compute(a, b) {
+		if e.Kind == Equal {
+			if current != nil {
+				result = append(result, *current)
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			current = &change{start: e.A, end: e.A}
+		}
+		switch e.Kind {
+		case Delete:
+			current.end = e.A + 1
+		case Insert:
+			current.lines = append(current.lines, b[e.B])
+		}
+	}
+	if current != nil {
+		result = append(result, *current)
+	}
+	return result
+}
+
+// apply returns the lines base[start:end] with the given changes applied.
+func apply(base []string, start int, end int, changes []change) []string {
+	var (
+		lines []string
+		pos   = start
+	)
+	for _, c := range changes {
+		lines = append(lines, base[pos:c.start]...)
+		lines = append(lines, c.lines...)
+		pos = c.end
+	}
+	return append(lines, base[pos:end]...)
+}
@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		ours      string
+		theirs    string
+		want      string
+		conflicts []Conflict
+	}{
+		{
+			name:   "unchanged",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nb\nc\n",
+		},
+		{
+			name:   "only ours",
+			base:   "a\nb\nc\n",
+			ours:   "a\nx\nc\n",
+			theirs: "a\nb\nc\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "only theirs",
+			base:   "a\nb\nc\n",
+			ours:   "a\nb\nc\n",
+			theirs: "a\nb\nc\nd\n",
+			want:   "a\nb\nc\nd\n",
+		},
+		{
+			name:   "clean",
+			base:   "1\n2\n3\n4\n5\n",
+			ours:   "x\n2\n3\n4\n5\n",
+			theirs: "1\n2\n3\n4\ny\n",
+			want:   "x\n2\n3\n4\ny\n",
+		},
+		{
+			name:   "clean delete and insert",
+			base:   "a\nb\nc\nd\ne\n",
+			ours:   "a\nc\nd\ne\n",
+			theirs: "a\nb\nc\nd\ne\nf\n",
+			want:   "a\nc\nd\ne\nf\n",
+		},
+		{
+			name:   "same change",
+			base:   "a\nb\nc\n",
+			ours:   "a\nx\nc\n",
+			theirs: "a\nx\nc\n",
+			want:   "a\nx\nc\n",
+		},
+		{
+			name:   "empty base",
+			base:   "",
+			ours:   "a\n",
+			theirs: "a\n",
+			want:   "a\n",
+		},
+		{
+			name:   "overlapping",
+			base:   "a\nb\nc\n",
+			ours:   "a\nx\nc\n",
+			theirs: "a\ny\nc\n",
+			want:   "a\nb\nc\n",
+			conflicts: []Conflict{
+				{BaseLine: 2, Base: "b\n", Ours: "x\n", Theirs: "y\n"},
+			},
+		},
+		{
+			name:   "touching",
+			base:   "a\nb\nc\nd\n",
+			ours:   "a\nx\nc\nd\n",
+			theirs: "a\nb\ny\nd\n",
+			want:   "a\nb\nc\nd\n",
+			conflicts: []Conflict{
+				{BaseLine: 2, Base: "b\nc\n", Ours: "x\nc\n", Theirs: "b\ny\n"},
+			},
+		},
+		{
+			name:   "insert at same line",
+			base:   "a\n",
+			ours:   "a\nx\n",
+			theirs: "a\ny\n",
+			want:   "a\n",
+			conflicts: []Conflict{
+				{BaseLine: 2, Base: "", Ours: "x\n", Theirs: "y\n"},
+			},
+		},
+		{
+			name:   "conflict and clean change",
+			base:   "1\n2\n3\n4\n5\n6\n",
+			ours:   "x\n2\n3\n4\n5\n6\n",
+			theirs: "y\n2\n3\n4\n5\nz\n",
+			want:   "1\n2\n3\n4\n5\nz\n",
+			conflicts: []Conflict{
+				{BaseLine: 1, Base: "1\n", Ours: "x\n", Theirs: "y\n"},
+			},
+		},
+		{
+			name:   "delete and edit",
+			base:   "a\nb\nc\n",
+			ours:   "a\nc\n",
+			theirs: "a\nx\nc\n",
+			want:   "a\nb\nc\n",
+			conflicts: []Conflict{
+				{BaseLine: 2, Base: "b\n", Ours: "", Theirs: "x\n"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge(tt.base, tt.ours, tt.theirs)
+			if got != tt.want {
+				t.Errorf("merged = %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(conflicts, tt.conflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrHunkNotApplicable = errors.New("hunk does not apply")
+
+	hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// FilePatch contains the hunks of a single file of a unified or git diff.
+// OldName is empty for added files and NewName is empty for removed files.
+type FilePatch struct {
+	OldName string
+	NewName string
+	Hunks   []Hunk
+}
+
+// ParseError is returned by Parse if the patch is malformed, Line is the 1-based line in the patch.
+type ParseError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid patch at line %d: %s", e.Line, e.Reason)
+}
+
+// HunkError is returned by Apply for every hunk which does not apply, Hunk is the 1-based index of the hunk and Line its start line in the old content.
+type HunkError struct {
+	Hunk int
+	Line int
+	Err  error
+}
+
+func (e *HunkError) Error() string {
+	return fmt.Sprintf("hunk #%d at line %d: %s", e.Hunk, e.Line, e.Err)
+}
+
+func (e *HunkError) Unwrap() error {
+	return e.Err
+}
+
+// Parse parses a unified or git style diff which can contain multiple files.
+// Lines outside of file headers and hunks are ignored, the a/ and b/ prefixes of git diffs are removed from the file names.
+func Parse(patch string) ([]FilePatch, error) {
+	var (
+		files   []FilePatch
+		current *FilePatch
+		// git diffs start a file with a diff --git line, which can be followed by --- & +++ lines
+		gitHeader bool
+	)
+	lines := Lines(patch)
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\n")
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			oldName, newName, ok := parseGitNames(strings.TrimPrefix(line, "diff --git "))
+			if !ok {
+				return nil, &ParseError{Line: i + 1, Reason: "invalid diff --git line"}
+			}
+			files = append(files, FilePatch{OldName: oldName, NewName: newName})
+			current = &files[len(files)-1]
+			gitHeader = true
+		case current != nil && gitHeader && strings.HasPrefix(line, "new file mode "):
+			current.OldName = ""
+		case current != nil && gitHeader && strings.HasPrefix(line, "deleted file mode "):
+			current.NewName = ""
+		case current != nil && gitHeader && strings.HasPrefix(line, "rename from "):
+			current.OldName = strings.TrimPrefix(line, "rename from ")
+		case current != nil && gitHeader && strings.HasPrefix(line, "rename to "):
+			current.NewName = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldName := parseName(strings.TrimPrefix(line, "--- "), "a/")
+			newName := parseName(strings.TrimPrefix(strings.TrimSuffix(lines[i+1], "\n"), "+++ "), "b/")
+			i++
+			if !gitHeader || current == nil {
+				files = append(files, FilePatch{})
+				current = &files[len(files)-1]
+			}
+			current.OldName = oldName
+			current.NewName = newName
+			gitHeader = false
+		case strings.HasPrefix(line, "@@ "):
+			if current == nil {
+				return nil, &ParseError{Line: i + 1, Reason: "hunk without file header"}
+			}
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			current.Hunks = append(current.Hunks, *hunk)
+			i = next - 1
+			gitHeader = false
+		}
+	}
+	if len(files) == 0 {
+		return nil, &ParseError{Line: 1, Reason: "no files found"}
+	}
+	return files, nil
+}
+
+// parseHunk parses the hunk starting at lines[start] and returns it with the index of the first line after it.
+func parseHunk(lines []string, start int) (*Hunk, int, error) {
+	match := hunkHeaderRegex.FindStringSubmatch(lines[start])
+	if match == nil {
+		return nil, 0, &ParseError{Line: start + 1, Reason: "invalid hunk header"}
+	}
+	h := Hunk{
+		AStart: atoi(match[1], 0),
+		ALines: atoi(match[2], 1),
+		BStart: atoi(match[3], 0),
+		BLines: atoi(match[4], 1),
+	}
+
+	var aLines, bLines int
+	i := start + 1
+	for ; i < len(lines) && (aLines < h.ALines || bLines < h.BLines || strings.HasPrefix(lines[i], `\`)); i++ {
+		line := lines[i]
+		switch line[0] {
+		case ' ':
+			aLines++
+			bLines++
+		case '-':
+			aLines++
+		case '+':
+			bLines++
+		case '\n':
+			// some editors strip the trailing space of empty context lines
+			line = " \n"
+			aLines++
+			bLines++
+		case '\\':
+			// "\ No newline at end of file" applies to the previous line
+			if len(h.Lines) > 0 {
+				h.Lines[len(h.Lines)-1] = strings.TrimSuffix(h.Lines[len(h.Lines)-1], "\n")
+			}
+			continue
+		default:
+			return nil, 0, &ParseError{Line: i + 1, Reason: "invalid hunk line"}
+		}
+		if !strings.HasSuffix(line, "\n") {
+			// the patch itself doesn't end with a newline
+			line += "\n"
+		}
+		h.Lines = append(h.Lines, line)
+	}
+	if aLines != h.ALines || bLines != h.BLines {
+		return nil, 0, &ParseError{Line: start + 1, Reason: "hunk line count does not match header"}
+	}
+	return &h, i, nil
+}
+
+// Apply applies the hunks to the content. A hunk is applied at its line or if the content moved at the nearest line where all its context & removed lines match.
+// It returns all hunks which could not be applied as HunkError.
+func Apply(content string, hunks []Hunk) (string, []error) {
+	lines := Lines(content)
+
+	var (
+		result []string
+		errs   []error
+		pos    int
+		offset int
+	)
+	for i, h := range hunks {
+		var oldLines, newLines []string
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				oldLines = append(oldLines, line[1:])
+				newLines = append(newLines, line[1:])
+			case '-':
+				oldLines = append(oldLines, line[1:])
+			case '+':
+				newLines = append(newLines, line[1:])
+			}
+		}
+
+		start := h.AStart - 1
+		if h.ALines == 0 {
+			// an empty range starts at the line before it
+			start = h.AStart
+		}
+		at := find(lines, oldLines, pos, start+offset)
+		if at == -1 {
+			errs = append(errs, &HunkError{Hunk: i + 1, Line: h.AStart, Err: ErrHunkNotApplicable})
+			continue
+		}
+
+		result = append(result, lines[pos:at]...)
+		result = append(result, newLines...)
+		pos = at + len(oldLines)
+		offset = at - start
+	}
+	result = append(result, lines[pos:]...)
+
+	if len(errs) > 0 {
+		return "", errs
+	}
+	return strings.Join(result, ""), nil
+}
+
+// find returns the index nearest to start but not before from where lines contains sub or -1 if there is none.
+func find(lines []string, sub []string, from int, start int) int {
+	matches := func(at int) bool {
+		if at < from || at+len(sub) > len(lines) {
+			return false
+		}
+		for i, line := range sub {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+
+	for delta := 0; start-delta >= from || start+delta <= len(lines); delta++ {
+		if matches(start - delta) {
+			return start - delta
+		}
+		if matches(start + delta) {
+			return start + delta
+		}
+	}
+	return -1
+}
+
+func parseGitNames(names string) (string, string, bool) {
+	oldName, newName, ok := strings.Cut(names, " b/")
+	if !ok || !strings.HasPrefix(oldName, "a/") {
+		return "", "", false
+	}
+	return strings.TrimPrefix(oldName, "a/"), newName, true
+}
+
+func parseName(name string, prefix string) string {
+	// unified diffs can contain a timestamp after the name
+	name, _, _ = strings.Cut(name, "\t")
+	if name == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+func atoi(s string, fallback int) int {
+	if s == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
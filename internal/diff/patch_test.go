@@ -0,0 +1,263 @@
+package diff
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  []FilePatch
+	}{
+		{
+			name:  "unified",
+			patch: "--- a/a.txt\t2024-01-01 00:00:00\n+++ b/a.txt\t2024-01-02 00:00:00\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			want: []FilePatch{
+				{OldName: "a.txt", NewName: "a.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 2, BStart: 1, BLines: 2, Lines: []string{" a\n", "-b\n", "+c\n"}},
+				}},
+			},
+		},
+		{
+			name:  "git rename",
+			patch: "diff --git a/old.txt b/new.txt\nsimilarity index 50%\nrename from old.txt\nrename to new.txt\nindex 7898192..6178079 100644\n--- a/old.txt\n+++ b/new.txt\n@@ -1 +1 @@\n-a\n+b\n",
+			want: []FilePatch{
+				{OldName: "old.txt", NewName: "new.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 1, BStart: 1, BLines: 1, Lines: []string{"-a\n", "+b\n"}},
+				}},
+			},
+		},
+		{
+			name:  "git rename without changes",
+			patch: "diff --git a/old.txt b/new.txt\nsimilarity index 100%\nrename from old.txt\nrename to new.txt\n",
+			want: []FilePatch{
+				{OldName: "old.txt", NewName: "new.txt"},
+			},
+		},
+		{
+			name:  "git new file",
+			patch: "diff --git a/new.txt b/new.txt\nnew file mode 100644\nindex 0000000..7898192\n--- /dev/null\n+++ b/new.txt\n@@ -0,0 +1 @@\n+a\n",
+			want: []FilePatch{
+				{OldName: "", NewName: "new.txt", Hunks: []Hunk{
+					{AStart: 0, ALines: 0, BStart: 1, BLines: 1, Lines: []string{"+a\n"}},
+				}},
+			},
+		},
+		{
+			name:  "git deleted file",
+			patch: "diff --git a/old.txt b/old.txt\ndeleted file mode 100644\nindex 7898192..0000000\n--- a/old.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+			want: []FilePatch{
+				{OldName: "old.txt", NewName: "", Hunks: []Hunk{
+					{AStart: 1, ALines: 1, BStart: 0, BLines: 0, Lines: []string{"-a\n"}},
+				}},
+			},
+		},
+		{
+			name:  "git empty new file",
+			patch: "diff --git a/empty.txt b/empty.txt\nnew file mode 100644\nindex 0000000..e69de29\n",
+			want: []FilePatch{
+				{OldName: "", NewName: "empty.txt"},
+			},
+		},
+		{
+			name:  "multiple files",
+			patch: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\ndiff --git a/b.txt b/b.txt\n--- a/b.txt\n+++ b/b.txt\n@@ -1 +1 @@\n-c\n+d\n",
+			want: []FilePatch{
+				{OldName: "a.txt", NewName: "a.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 1, BStart: 1, BLines: 1, Lines: []string{"-a\n", "+b\n"}},
+				}},
+				{OldName: "b.txt", NewName: "b.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 1, BStart: 1, BLines: 1, Lines: []string{"-c\n", "+d\n"}},
+				}},
+			},
+		},
+		{
+			name:  "no newline at end of file",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+			want: []FilePatch{
+				{OldName: "a.txt", NewName: "a.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 1, BStart: 1, BLines: 1, Lines: []string{"-a", "+a\n"}},
+				}},
+			},
+		},
+		{
+			name:  "stripped empty context line",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n\n-a\n+b\n",
+			want: []FilePatch{
+				{OldName: "a.txt", NewName: "a.txt", Hunks: []Hunk{
+					{AStart: 1, ALines: 2, BStart: 1, BLines: 2, Lines: []string{" \n", "-a\n", "+b\n"}},
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.patch)
+			if err != nil {
+				t.Fatalf("failed to parse patch: %s", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+		want  ParseError
+	}{
+		{
+			name:  "no files",
+			patch: "hello\n",
+			want:  ParseError{Line: 1, Reason: "no files found"},
+		},
+		{
+			name:  "hunk without file header",
+			patch: "@@ -1 +1 @@\n-a\n+b\n",
+			want:  ParseError{Line: 1, Reason: "hunk without file header"},
+		},
+		{
+			name:  "invalid diff --git line",
+			patch: "diff --git old.txt new.txt\n",
+			want:  ParseError{Line: 1, Reason: "invalid diff --git line"},
+		},
+		{
+			name:  "invalid hunk header",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -a +b @@\n",
+			want:  ParseError{Line: 3, Reason: "invalid hunk header"},
+		},
+		{
+			name:  "invalid hunk line",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n*b\n+c\n",
+			want:  ParseError{Line: 5, Reason: "invalid hunk line"},
+		},
+		{
+			name:  "line count mismatch",
+			patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+c\n",
+			want:  ParseError{Line: 3, Reason: "hunk line count does not match header"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.patch)
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("err = %v, want %v", err, &tt.want)
+			}
+			if *parseErr != tt.want {
+				t.Errorf("err = %v, want %v", parseErr, &tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		patch   string
+		want    string
+	}{
+		{
+			name:    "at line",
+			content: "a\nb\nc\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+			want:    "a\nx\nc\n",
+		},
+		{
+			name:    "moved down",
+			content: "1\n2\na\nb\nc\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+			want:    "1\n2\na\nx\nc\n",
+		},
+		{
+			name:    "moved up",
+			content: "a\nb\nc\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -3,3 +3,3 @@\n a\n-b\n+x\n c\n",
+			want:    "a\nx\nc\n",
+		},
+		{
+			name:    "offset of previous hunk",
+			content: "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,3 @@\n 0\n+x\n 1\n@@ -8,2 +9,2 @@\n 7\n-8\n+y\n",
+			want:    "0\nx\n1\n2\n3\n4\n5\n6\n7\ny\n9\n",
+		},
+		{
+			name:    "nearest match",
+			content: "a\nb\n1\n2\n3\na\nb\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -5,2 +5,2 @@\n a\n-b\n+x\n",
+			want:    "a\nb\n1\n2\n3\na\nx\n",
+		},
+		{
+			name:    "insert after line",
+			content: "a\nb\n",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,0 +2 @@\n+x\n",
+			want:    "a\nx\nb\n",
+		},
+		{
+			name:    "new file",
+			content: "",
+			patch:   "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want:    "a\nb\n",
+		},
+		{
+			name:    "no newline at end of file",
+			content: "a\nb",
+			patch:   "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+			want:    "a\nb\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patches, err := Parse(tt.patch)
+			if err != nil {
+				t.Fatalf("failed to parse patch: %s", err)
+			}
+			got, errs := Apply(tt.content, patches[0].Hunks)
+			if len(errs) > 0 {
+				t.Fatalf("failed to apply patch: %v", errs)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHunkErrors(t *testing.T) {
+	// the context lines have to match exactly, hunks are not applied with fuzz
+	patches, err := Parse("--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+x\n@@ -4,2 +4,2 @@\n d\n-e\n+y\n@@ -7,2 +7,2 @@\n g\n-z\n+h\n")
+	if err != nil {
+		t.Fatalf("failed to parse patch: %s", err)
+	}
+
+	got, errs := Apply("a\nb\nc\nD\ne\nf\ng\nh\n", patches[0].Hunks)
+	if got != "" {
+		t.Errorf("Apply() = %q, want %q", got, "")
+	}
+	want := []HunkError{
+		{Hunk: 2, Line: 4, Err: ErrHunkNotApplicable},
+		{Hunk: 3, Line: 7, Err: ErrHunkNotApplicable},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("errs = %v, want %d errors", errs, len(want))
+	}
+	for i, err := range errs {
+		var hunkErr *HunkError
+		if !errors.As(err, &hunkErr) {
+			t.Fatalf("errs[%d] = %v, want %v", i, err, &want[i])
+		}
+		if *hunkErr != want[i] {
+			t.Errorf("errs[%d] = %v, want %v", i, hunkErr, &want[i])
+		}
+		if !errors.Is(err, ErrHunkNotApplicable) {
+			t.Errorf("errs[%d] = %v, want wrapped %v", i, err, ErrHunkNotApplicable)
+		}
+	}
+}
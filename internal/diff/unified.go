@@ -0,0 +1,118 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DefaultContext = 3
+
+// Hunk is a group of changed lines with surrounding context lines.
+// Lines are prefixed with ' ', '-' or '+' and keep their trailing newline.
+// AStart and BStart are 1-based like in the unified diff format.
+type Hunk struct {
+	AStart int
+	ALines int
+	BStart int
+	BLines int
+	Lines  []string
+}
+
+// Hunks groups the edits of a into b into hunks with the given amount of context lines.
+func Hunks(a []string, b []string, edits []Edit, context int) []Hunk {
+	var (
+		hunks []Hunk
+		start = -1
+		end   int
+	)
+	for i, e := range edits {
+		if e.Kind == Equal {
+			continue
+		}
+		if start == -1 || i-end > 2*context {
+			if start != -1 {
+				hunks = append(hunks, newHunk(a, b, edits, start, end, context))
+			}
+			start = i
+		}
+		end = i + 1
+	}
+	if start != -1 {
+		hunks = append(hunks, newHunk(a, b, edits, start, end, context))
+	}
+	return hunks
+}
+
+func newHunk(a []string, b []string, edits []Edit, start int, end int, context int) Hunk {
+	start = max(start-context, 0)
+	end = min(end+context, len(edits))
+
+	h := Hunk{
+		AStart: edits[start].A + 1,
+		BStart: edits[start].B + 1,
+	}
+	for _, e := range edits[start:end] {
+		switch e.Kind {
+		case Equal:
+			h.Lines = append(h.Lines, " "+a[e.A])
+			h.ALines++
+			h.BLines++
+		case Delete:
+			h.Lines = append(h.Lines, "-"+a[e.A])
+			h.ALines++
+		case Insert:
+			h.Lines = append(h.Lines, "+"+b[e.B])
+			h.BLines++
+		}
+	}
+	// an empty range starts at the line before it
+	if h.ALines == 0 {
+		h.AStart--
+	}
+	if h.BLines == 0 {
+		h.BStart--
+	}
+	return h
+}
+
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.AStart, h.ALines), hunkRange(h.BStart, h.BLines))
+}
+
+func hunkRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Unified returns the unified diff between the old and new content.
+// An empty name is rendered as /dev/null. It returns an empty string if both contents are equal.
+func Unified(oldName string, newName string, oldContent string, newContent string) string {
+	a, b := Lines(oldContent), Lines(newContent)
+	hunks := Hunks(a, b, Compute(a, b), DefaultContext)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	buf := new(strings.Builder)
+	_, _ = fmt.Fprintf(buf, "--- %s\n+++ %s\n", fileName("a/", oldName), fileName("b/", newName))
+	for _, h := range hunks {
+		buf.WriteString(h.Header())
+		buf.WriteByte('\n')
+		for _, line := range h.Lines {
+			buf.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String()
+}
+
+func fileName(prefix string, name string) string {
+	if name == "" {
+		return "/dev/null"
+	}
+	return prefix + name
+}
@@ -11,17 +11,22 @@ import (
 )
 
 const (
+	HeaderAccept             = "Accept"
 	HeaderContentType        = "Content-Type"
 	HeaderContentLength      = "Content-Length"
 	HeaderContentDisposition = "Content-Disposition"
 	HeaderUserAgent          = "User-Agent"
 	HeaderAuthorization      = "Authorization"
 	HeaderLanguage           = "Language"
+	HeaderMessage            = "Message"
+	HeaderPassword           = "Password"
 	HeaderRateLimitLimit     = "X-RateLimit-Limit"
 	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
 	HeaderRateLimitReset     = "X-RateLimit-Reset"
 	HeaderRetryAfter         = "Retry-After"
 	HeaderCacheControl       = "Cache-Control"
+	HeaderETag               = "ETag"
+	HeaderIfMatch            = "If-Match"
 )
 
 const (
@@ -29,6 +34,7 @@ const (
 	ContentTypeCSS    = "text/css; charset=UTF-8"
 	ContentTypeHTML   = "text/html; charset=UTF-8"
 	ContentTypeText   = "text/plain; charset=UTF-8"
+	ContentTypeDiff   = "text/x-diff; charset=UTF-8"
 	ContentTypeSVG    = "image/svg+xml"
 	ContentTypePNG    = "image/png"
 	ContentTypeJSON   = "application/json"
@@ -86,6 +92,10 @@ func Get(path string) (*http.Response, error) {
 	return Do(http.MethodGet, path, "", nil)
 }
 
+func GetToken(path string, token string) (*http.Response, error) {
+	return Do(http.MethodGet, path, token, nil)
+}
+
 func Post(path string, body io.Reader) (*http.Response, error) {
 	return Do(http.MethodPost, path, "", body)
 }
@@ -103,6 +113,9 @@ func Delete(path string, token string) (*http.Response, error) {
 }
 
 func ProcessBody(method string, rs *http.Response, body any) error {
+	if rs.StatusCode == http.StatusNoContent {
+		return nil
+	}
 	if rs.StatusCode >= http.StatusOK && rs.StatusCode < http.StatusMultipleChoices {
 		if err := json.NewDecoder(rs.Body).Decode(body); err != nil {
 			return fmt.Errorf("failed to decode response: %w", err)
@@ -62,6 +62,10 @@ func Forbidden(err error) error {
 	return New(err, http.StatusForbidden)
 }
 
+func Conflict(err error) error {
+	return New(err, http.StatusConflict)
+}
+
 func TooManyRequests(err error) error {
 	return New(err, http.StatusTooManyRequests)
 }
@@ -47,6 +47,20 @@ func (c *counter) Try(key string) (bool, int, time.Time) {
 	return true, v.value, v.resetAt
 }
 
+// Return gives back a request counted by Try, unless the window it was counted in is over.
+func (c *counter) Return(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.counters[counterKey(key)]
+	if !ok || time.Now().After(v.resetAt) {
+		return
+	}
+	if v.value < c.requestLimit {
+		v.value += 1
+	}
+}
+
 func (c *counter) Cleanup() {
 	ticker := time.NewTicker(time.Second * 10)
 	defer ticker.Stop()
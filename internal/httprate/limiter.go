@@ -36,32 +36,55 @@ type RateLimiter struct {
 
 func (l *RateLimiter) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := getKey(r)
-
-		l.mu.Lock()
-		ok, remaining, reset := l.limitCounter.Try(key)
-		w.Header().Set(ezhttp.HeaderRateLimitLimit, strconv.Itoa(l.requestLimit))
-		w.Header().Set(ezhttp.HeaderRateLimitRemaining, strconv.Itoa(remaining))
-		w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.FormatInt(reset.Unix(), 10))
-
-		if !ok {
-			w.Header().Set(ezhttp.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(time.Until(reset).Seconds())), 10))
+		if !l.Allow(w, getKey(r)) {
 			l.onRequestLimit(w, r)
-			l.mu.Unlock()
 			return
 		}
-		l.mu.Unlock()
-
 		next.ServeHTTP(w, r)
 	})
 }
 
+// Allow counts a request for the key and reports whether it is within the limit.
+// The rate limit headers are set on the response.
+func (l *RateLimiter) Allow(w http.ResponseWriter, key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ok, remaining, reset := l.limitCounter.Try(key)
+	w.Header().Set(ezhttp.HeaderRateLimitLimit, strconv.Itoa(l.requestLimit))
+	w.Header().Set(ezhttp.HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	w.Header().Set(ezhttp.HeaderRateLimitReset, strconv.FormatInt(reset.Unix(), 10))
+
+	if !ok {
+		w.Header().Set(ezhttp.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(time.Until(reset).Seconds())), 10))
+	}
+	return ok
+}
+
+// Refund gives back a request counted by Allow for the key, so it doesn't count towards the limit.
+func (l *RateLimiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limitCounter.Return(key)
+}
+
 func getKey(r *http.Request) string {
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	return IPKey(r) + ":" + r.URL.Path
+}
+
+// IPKey returns the canonicalized IP of the client of the request.
+func IPKey(r *http.Request) string {
+	return AddrKey(r.RemoteAddr)
+}
+
+// AddrKey returns the canonicalized IP of an address with or without port.
+func AddrKey(addr string) string {
+	ip, _, err := net.SplitHostPort(addr)
 	if err != nil {
-		ip = r.RemoteAddr
+		ip = addr
 	}
-	return canonicalizeIP(ip) + ":" + r.URL.Path
+	return canonicalizeIP(ip)
 }
 
 // canonicalizeIP returns a form of ip suitable for comparison to other IPs.
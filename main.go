@@ -37,7 +37,24 @@ var (
 	Styles embed.FS
 )
 
+// commands are subcommands of the server binary, without a subcommand the server is started.
+var commands = map[string]func(args []string) error{
+	"migrate-db": migrateDB,
+	"backup":     backupDB,
+	"restore":    restoreDB,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				slog.Error("Error while running command", slog.String("command", os.Args[1]), slog.Any("err", err))
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	cfgPath := flag.String("config", "gobin.toml", "path to gobin.toml")
 	flag.Parse()
 
@@ -70,6 +87,14 @@ func main() {
 		}
 	}()
 
+	var snapshots database.SnapshotStore
+	if cfg.Database.Backup.Enabled {
+		if snapshots, err = database.NewSnapshotStore(ctx, cfg.Database); err != nil {
+			slog.Error("Error while creating database backup store", slog.Any("err", err))
+			return
+		}
+	}
+
 	signer, err := jose.NewSigner(jose.SigningKey{
 		Algorithm: jose.HS512,
 		Key:       []byte(cfg.JWTSecret),
@@ -116,7 +141,7 @@ func main() {
 	formatters.Register("html", htmlFormatter)
 	formatters.Register("html-standalone", standaloneHTMLFormatter)
 
-	s := server.NewServer(version, cfg.DevMode, cfg, db, signer, assets, htmlFormatter, standaloneHTMLFormatter)
+	s := server.NewServer(version, cfg.DevMode, cfg, db, snapshots, signer, assets, htmlFormatter, standaloneHTMLFormatter)
 	slog.Info("Gobin started...", slog.String("address", cfg.ListenAddr))
 	go s.Start()
 	defer s.Close()
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/topi314/gobin/v3/server"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+// migrateDB copies all data from the database of one config to the database of another config, for example from SQLite to PostgreSQL.
+func migrateDB(args []string) error {
+	flags := flag.NewFlagSet("migrate-db", flag.ExitOnError)
+	fromPath := flags.String("from", "", "path to the gobin.toml of the source database")
+	toPath := flags.String("to", "", "path to the gobin.toml of the destination database")
+	batchSize := flags.Int("batch-size", 500, "number of rows copied per batch")
+	_ = flags.Parse(args)
+
+	if *fromPath == "" || *toPath == "" {
+		flags.Usage()
+		return fmt.Errorf("--from and --to are required")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("--batch-size must be greater than 0")
+	}
+
+	fromCfg, err := server.LoadConfig(*fromPath)
+	if err != nil {
+		return fmt.Errorf("failed to load source config: %w", err)
+	}
+	toCfg, err := server.LoadConfig(*toPath)
+	if err != nil {
+		return fmt.Errorf("failed to load destination config: %w", err)
+	}
+	setupLogger(fromCfg.Log)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	from, err := openDB(ctx, fromCfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer func() {
+		_ = from.Close()
+	}()
+	to, err := openDB(ctx, toCfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open destination database: %w", err)
+	}
+	defer func() {
+		_ = to.Close()
+	}()
+
+	if fromCfg.Database.ObjectStore.Enabled && (!toCfg.Database.ObjectStore.Enabled ||
+		fromCfg.Database.ObjectStore.Endpoint != toCfg.Database.ObjectStore.Endpoint ||
+		fromCfg.Database.ObjectStore.Bucket != toCfg.Database.ObjectStore.Bucket ||
+		fromCfg.Database.ObjectStore.Prefix != toCfg.Database.ObjectStore.Prefix) {
+		slog.Warn("The object store is not copied, file contents stored in it are only readable if the destination uses the same object store")
+	}
+
+	slog.Info("Migrating database...", slog.String("from", string(fromCfg.Database.Type)), slog.String("to", string(toCfg.Database.Type)))
+	if err = database.Transfer(ctx, from, to, *batchSize, func(progress database.TransferProgress) {
+		if progress.Done {
+			slog.Info("Copied table", slog.String("table", progress.Table), slog.Int64("rows", progress.Copied))
+			return
+		}
+		slog.Debug("Copied batch", slog.String("table", progress.Table), slog.Int64("rows", progress.Copied))
+	}); err != nil {
+		if errors.Is(err, database.ErrTransferDestinationNotEmpty) {
+			return err
+		}
+		return fmt.Errorf("failed to migrate database, run the command again to resume: %w", err)
+	}
+
+	slog.Info("Verifying database...")
+	checksums, err := database.VerifyTransfer(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to verify database: %w", err)
+	}
+	for _, checksum := range checksums {
+		slog.Info("Verified table", slog.String("table", checksum.Table), slog.Int64("rows", checksum.Rows), slog.String("checksum", fmt.Sprintf("%016x", checksum.Checksum)))
+	}
+	slog.Info("Database migrated")
+	return nil
+}
+
+func openDB(ctx context.Context, cfg database.Config) (database.DB, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	return database.New(ctx, cfg, Migrations)
+}
@@ -5,8 +5,12 @@ document.addEventListener("DOMContentLoaded", async () => {
     const state = JSON.parse(document.getElementById("state").textContent);
 
     const params = new URLSearchParams(window.location.search);
-    if (params.has("token")) {
-        setToken(state.key, params.get("token"));
+    const token = params.get("token");
+    // tokens scoped to a version or files are not stored, they would replace the token of the whole document
+    if (token && !isScoped(token)) {
+        setToken(state.key, token);
+    } else if (!token && state.key && getToken(state.key)) {
+        setToken(state.key, getToken(state.key));
     }
 
     updateButtons(state);
@@ -180,6 +184,12 @@ document.getElementById("code-edit").addEventListener("keyup", (event) => {
 document.getElementById("version").addEventListener("change", async (e) => {
     const state = getState();
 
+    if (e.target.value === "more") {
+        e.target.value = state.version !== 0 ? state.version : e.target.options.item(0).value;
+        await loadMoreVersions(state.key);
+        return;
+    }
+
     let newVersion = e.target.value;
     if (newVersion === state.version) {
         return;
@@ -188,6 +198,12 @@ document.getElementById("version").addEventListener("change", async (e) => {
         newVersion = 0;
     }
 
+    if (state.compare) {
+        state.version = parseInt(newVersion);
+        window.location.href = getURL(state);
+        return;
+    }
+
     const document = await fetchDocument(state.key, newVersion);
     if (!document) {
         return;
@@ -203,10 +219,37 @@ document.getElementById("version").addEventListener("change", async (e) => {
 
     updateFiles(state)
     updateCode(state)
+    updateButtons(state)
 
     addState(state)
 });
 
+document.getElementById("blame").addEventListener("click", () => {
+    const state = getState();
+    state.blame = !state.blame;
+
+    updateCode(state);
+    updateButtons(state);
+    setState(state);
+});
+
+document.getElementById("compare").addEventListener("change", async (e) => {
+    if (e.target.value === "more") {
+        e.target.value = getState().compare || "0";
+        await loadMoreVersions(getState().key);
+        return;
+    }
+
+    const url = new URL(window.location.href);
+    if (e.target.value === "0") {
+        url.searchParams.delete("compare");
+    } else {
+        url.searchParams.set("compare", e.target.value);
+    }
+    url.searchParams.delete("file");
+    window.location.href = url.toString();
+});
+
 document.getElementById("style").addEventListener("change", (e) => {
     const style = e.target.value;
     const theme = e.target.options.item(e.target.selectedIndex).dataset.theme;
@@ -270,6 +313,8 @@ document.getElementById("edit").addEventListener("click", async () => {
     }
     state.mode = "edit";
     state.version = 0;
+    // remember the latest known version to detect concurrent updates
+    state.base_version = state.key ? parseInt(document.getElementById("version").options.item(0).value) : 0;
 
     updateCode(state);
     updateButtons(state);
@@ -287,7 +332,7 @@ document.getElementById("save").addEventListener("click", async () => {
 
     const saveButton = document.getElementById("save");
     saveButton.classList.add("loading");
-    const doc = await saveDocument(state.key, state.expire_in, state.files);
+    const doc = await saveDocument(state.key, state.base_version, state.expire_in, document.getElementById("private").checked, document.getElementById("password").value, state.files);
     saveButton.classList.remove("loading");
 
     if (!doc) {
@@ -301,25 +346,49 @@ document.getElementById("save").addEventListener("click", async () => {
 
     if (doc.token) {
         setToken(doc.key, doc.token);
+        // only new documents get a token
+        document.getElementById("share-private").checked = document.getElementById("private").checked;
     }
 
-    const optionElement = document.createElement("option");
-    optionElement.title = `${doc.version_time}`;
-    optionElement.value = doc.version;
-    optionElement.innerText = `${doc.version_label}`;
-
-    updateVersionSelect(-1);
-    const versionElement = document.getElementById("version");
-    versionElement.insertBefore(optionElement, versionElement.firstChild);
-    versionElement.value = doc.version;
+    addVersionOption(doc);
 
     document.getElementById("expire").value = "";
+    document.getElementById("private").checked = false;
+    document.getElementById("password").value = "";
 
     updateCode(state);
     updateButtons(state);
     addState(state);
 });
 
+document.getElementById("restore").addEventListener("click", async () => {
+    const state = getState();
+    if (state.mode !== "view" || state.version === 0) {
+        return;
+    }
+
+    const restoreButton = document.getElementById("restore");
+    restoreButton.classList.add("loading");
+    const doc = await restoreDocumentVersion(state.key, state.version);
+    restoreButton.classList.remove("loading");
+
+    if (!doc) {
+        return;
+    }
+    state.version = 0;
+    state.files = doc.files;
+    if (state.current_file >= state.files.length) {
+        state.current_file = state.files.length - 1;
+    }
+
+    addVersionOption(doc);
+
+    updateFiles(state);
+    updateCode(state);
+    updateButtons(state);
+    addState(state);
+});
+
 document.getElementById("delete").addEventListener("click", async () => {
     if (document.getElementById("delete").disabled) {
         return;
@@ -391,6 +460,11 @@ document.getElementById("share").addEventListener("click", async () => {
     document.getElementById("share-permissions-write").checked = false;
     document.getElementById("share-permissions-delete").checked = false;
     document.getElementById("share-permissions-share").checked = false;
+    document.getElementById("share-permissions-read").checked = false;
+    document.getElementById("share-expires-in").value = "";
+    document.getElementById("share-scope-version").checked = false;
+    document.getElementById("share-scope-file").checked = false;
+    document.getElementById("share-private").disabled = !hasPermission(token, PermissionWrite);
 
     document.getElementById("share-dialog").showModal();
 });
@@ -413,6 +487,16 @@ document.getElementById("share-copy").addEventListener("click", async () => {
     if (document.getElementById("share-permissions-webhook").checked) {
         permissions.push("webhook");
     }
+    if (document.getElementById("share-permissions-read").checked) {
+        permissions.push("read");
+    }
+
+    const scopeVersion = document.getElementById("share-scope-version").checked;
+    const scopeFile = document.getElementById("share-scope-file").checked;
+    // scoped tokens can only read
+    if (permissions.length === 0 && (scopeVersion || scopeFile)) {
+        permissions.push("read");
+    }
 
     if (permissions.length === 0) {
         await navigator.clipboard.writeText(window.location.href);
@@ -420,12 +504,25 @@ document.getElementById("share-copy").addEventListener("click", async () => {
         return;
     }
 
-    const {key} = getState();
+    const state = getState();
+    const key = state.key;
     const token = getToken(key);
 
+    const shareRequest = {permissions: permissions};
+    const expiresIn = document.getElementById("share-expires-in").value;
+    if (expiresIn) {
+        shareRequest.expires_in = expiresIn;
+    }
+    if (scopeVersion) {
+        shareRequest.version = `${state.version !== 0 ? state.version : document.getElementById("version").options.item(0).value}`;
+    }
+    if (scopeFile) {
+        shareRequest.files = [state.files[state.current_file].name];
+    }
+
     const response = await fetch(`/documents/${key}/share`, {
         method: "POST",
-        body: JSON.stringify({permissions: permissions}),
+        body: JSON.stringify(shareRequest),
         headers: {
             "Content-Type": "application/json",
             Authorization: `Bearer ${token}`
@@ -445,7 +542,44 @@ document.getElementById("share-copy").addEventListener("click", async () => {
     document.getElementById("share-dialog").close();
 });
 
-async function saveDocument(key, expire, files) {
+document.getElementById("share-private").addEventListener("change", async (e) => {
+    const {key} = getState();
+    const token = getToken(key);
+
+    const response = await fetch(`/documents/${key}/visibility`, {
+        method: "PUT",
+        body: JSON.stringify({visibility: e.target.checked ? "private" : "public"}),
+        headers: {
+            "Content-Type": "application/json",
+            Authorization: `Bearer ${token}`
+        }
+    });
+
+    if (!response.ok) {
+        e.target.checked = !e.target.checked;
+        const body = await response.json();
+        showErrorPopup(body.message || response.statusText)
+        console.error("error changing document visibility:", response);
+    }
+});
+
+document.getElementById("fork").addEventListener("click", async () => {
+    if (document.getElementById("fork").disabled) return;
+
+    const {key, version} = getState();
+    if (!key) return;
+
+    const forkButton = document.getElementById("fork");
+    forkButton.classList.add("loading");
+    const doc = await forkDocument(key, version);
+    forkButton.classList.remove("loading");
+    if (!doc) return;
+
+    setToken(doc.key, doc.token);
+    window.location.href = `/${doc.key}`;
+})
+
+async function saveDocument(key, baseVersion, expire, privateDocument, password, files) {
     const data = new FormData();
     for (const [i, file] of files.entries()) {
         const blob = new Blob([file.content], {
@@ -460,6 +594,14 @@ async function saveDocument(key, expire, files) {
         headers["Authorization"] = `Bearer ${token}`
     }
 
+    if (!key && password) {
+        headers["Password"] = password;
+    }
+
+    if (key && baseVersion) {
+        headers["If-Match"] = `"${baseVersion}"`;
+    }
+
     if (expire) {
         try {
             headers["Expires"] = new Date(Date.now() + expire * 60 * 60 * 1000).toISOString();
@@ -469,7 +611,7 @@ async function saveDocument(key, expire, files) {
         }
     }
 
-    const response = await fetch(`/documents/${key}?formatter=html`, {
+    const response = await fetch(`/documents/${key}?formatter=html${!key && privateDocument ? "&visibility=private" : ""}`, {
         body: data,
         method: key !== "" ? "PATCH" : "POST",
         headers: headers
@@ -482,6 +624,16 @@ async function saveDocument(key, expire, files) {
         body = {message: body};
     }
 
+    if (response.status === 409) {
+        let message = "The document has been updated in the meantime.";
+        if (body.conflicts) {
+            message += ` Your changes conflict in: ${body.conflicts.map(file => file.name).join(", ")}.`;
+        }
+        showErrorPopup(message + " Copy your changes and reload the page.");
+        console.error("error saving document:", response);
+        return;
+    }
+
     if (!response.ok) {
         showErrorPopup(body.message || response.statusText);
         console.error("error saving document:", response);
@@ -491,6 +643,39 @@ async function saveDocument(key, expire, files) {
     return body
 }
 
+async function restoreDocumentVersion(key, version) {
+    const response = await fetch(`/documents/${key}/versions/${version}/restore?formatter=html`, {
+        method: "POST",
+        headers: {
+            Authorization: `Bearer ${getToken(key)}`
+        }
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error restoring document version:", response);
+        return;
+    }
+
+    return body;
+}
+
+async function forkDocument(key, version) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/fork`, {
+        method: "POST"
+    });
+
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error forking document:", response);
+        return;
+    }
+
+    return body;
+}
+
 async function fetchDocument(key, version) {
     const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}?formatter=html`, {
         method: "GET"
@@ -591,6 +776,15 @@ function getToken(key) {
     const token = JSON.parse(documents)[key]
     if (!token) return ""
 
+    const tokenSplit = token.split(".")
+    if (tokenSplit.length === 3) {
+        const exp = JSON.parse(atob(tokenSplit[1])).exp;
+        if (exp && exp * 1000 < Date.now()) {
+            deleteToken(key);
+            return ""
+        }
+    }
+
     return token
 }
 
@@ -602,6 +796,8 @@ function setToken(key, token) {
     const parsedDocuments = JSON.parse(documents)
     parsedDocuments[key] = token
     localStorage.setItem("documents", JSON.stringify(parsedDocuments))
+    // the server reads private documents with the token cookie, as navigating can't send the Authorization header
+    setCookie(`token_${key}`, token, {sameSite: "lax", "max-age": 60 * 60 * 24 * 365});
 }
 
 function deleteToken(key) {
@@ -610,6 +806,7 @@ function deleteToken(key) {
     const parsedDocuments = JSON.parse(documents);
     delete parsedDocuments[key]
     localStorage.setItem("documents", JSON.stringify(parsedDocuments));
+    setCookie(`token_${key}`, "", {"max-age": 0});
 }
 
 const PermissionWrite = 1
@@ -617,6 +814,12 @@ const PermissionDelete = 2
 const PermissionShare = 4
 const PermissionWebhook = 8
 
+function isScoped(token) {
+    const tokenSplit = token.split(".")
+    if (tokenSplit.length !== 3) return false;
+    return !!JSON.parse(atob(tokenSplit[1])).scp;
+}
+
 function hasPermission(token, permission) {
     if (!token) return false;
     const tokenSplit = token.split(".")
@@ -632,11 +835,61 @@ function updateVersionSelect(currentIndex) {
             element.innerText = element.innerText.substring(0, element.innerText.length - 10);
         }
     }
-    if (currentIndex !== versionElement.options.length - 1 && currentIndex !== -1) {
+    if (currentIndex !== -1 && !versionElement.options.item(currentIndex).innerText.endsWith(" (original)")) {
         versionElement.options.item(currentIndex).innerText += " (current)";
     }
 }
 
+function addVersionOption(doc) {
+    const optionElement = document.createElement("option");
+    optionElement.title = `${doc.version_time}`;
+    optionElement.value = doc.version;
+    optionElement.innerText = `${doc.version_label}`;
+
+    updateVersionSelect(-1);
+    const versionElement = document.getElementById("version");
+    versionElement.insertBefore(optionElement, versionElement.firstChild);
+    versionElement.value = doc.version;
+}
+
+async function loadMoreVersions(key) {
+    const selects = [document.getElementById("version"), document.getElementById("compare")];
+    const moreOption = selects[0].querySelector(`option[value="more"]`);
+    if (!moreOption) {
+        return;
+    }
+
+    const response = await fetch(`/documents/${key}/versions?before=${moreOption.dataset.before}`);
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document versions:", response);
+        return;
+    }
+
+    for (const select of selects) {
+        const more = select.querySelector(`option[value="more"]`);
+        for (const version of body.versions) {
+            // the selected versions are rendered even if they are not on the first page, move them into place
+            const existing = select.querySelector(`option[value="${version.version}"]`);
+            if (existing) {
+                select.insertBefore(existing, more);
+                continue;
+            }
+            const option = document.createElement("option");
+            option.title = version.message ? `${version.version_time}\n${version.message}` : version.version_time;
+            option.value = version.version;
+            option.innerText = version.version_label;
+            select.insertBefore(option, more);
+        }
+        if (body.next_before) {
+            more.dataset.before = body.next_before;
+        } else {
+            more.remove();
+        }
+    }
+}
+
 function updateFiles(state) {
     const nodes = [];
     for (const [i, file] of state.files.entries()) {
@@ -681,6 +934,35 @@ function updateCode(state) {
     document.getElementById("code-edit").value = file.content;
     document.getElementById("code-view").innerHTML = file.formatted;
     document.getElementById("language").value = file.language;
+
+    if (state.mode === "view" && state.blame && state.key && !state.compare) {
+        showBlame(state.key, state.version, file.name);
+    }
+}
+
+async function showBlame(key, version, fileName) {
+    const response = await fetch(`/documents/${key}${version !== 0 ? `/versions/${version}` : ""}/blame?file=${encodeURIComponent(fileName)}`);
+    const body = await response.json();
+    if (!response.ok) {
+        showErrorPopup(body.message || response.statusText);
+        console.error("error fetching document blame:", response);
+        return;
+    }
+
+    const state = getState();
+    if (!state.blame || state.key !== key || state.version !== version || state.files[state.current_file].name !== fileName) {
+        return;
+    }
+
+    const lines = document.querySelectorAll("#code-view > .ch-line");
+    for (const [i, line] of body.lines.entries()) {
+        if (i >= lines.length) break;
+        const blame = document.createElement("span");
+        blame.classList.add("blame");
+        blame.innerText = `${line.version_time}${line.message ? ` ${line.message.split("\n")[0]}` : ""}`;
+        blame.title = `${line.version}${line.message ? `\n${line.message}` : ""}`;
+        lines[i].prepend(blame);
+    }
 }
 
 function updateButtons(state) {
@@ -701,18 +983,33 @@ function updateButtons(state) {
     const copyButton = document.getElementById("copy");
     const rawButton = document.getElementById("raw");
     const shareButton = document.getElementById("share");
+    const forkButton = document.getElementById("fork");
     const expireLabel = document.querySelector(`label[for="expire"]`);
+    const privateLabel = document.querySelector(`label[for="private"]`);
+    const passwordLabel = document.querySelector(`label[for="password"]`);
     const versionSelect = document.getElementById("version");
     versionSelect.disabled = versionSelect.options.length <= 1;
+    const compareSelect = document.getElementById("compare");
+    compareSelect.disabled = state.mode !== "view" || versionSelect.options.length <= 1;
+    document.getElementById("language").disabled = !!state.compare;
+    const blameButton = document.getElementById("blame");
+    blameButton.style.display = state.mode === "view" && state.key && !state.compare ? "block" : "none";
+    blameButton.classList.toggle("active", !!state.blame);
+    const restoreButton = document.getElementById("restore");
+    restoreButton.style.display = state.mode === "view" && state.version !== 0 && !state.compare && hasPermission(token, PermissionWrite) ? "block" : "none";
     if (state.mode === "view") {
         fileAddButton.style.display = "none";
         saveButton.style.display = "none";
         editButton.style.display = "block";
+        editButton.disabled = !!state.compare;
         deleteButton.disabled = !hasPermission(token, PermissionDelete);
         copyButton.disabled = false;
         rawButton.disabled = false;
         shareButton.disabled = false;
+        forkButton.disabled = false;
         expireLabel.style.display = "none";
+        privateLabel.style.display = "none";
+        passwordLabel.style.display = "none";
         return;
     }
     fileAddButton.style.display = "block";
@@ -723,7 +1020,11 @@ function updateButtons(state) {
     copyButton.disabled = true;
     rawButton.disabled = true;
     shareButton.disabled = true;
+    forkButton.disabled = true;
     expireLabel.style.display = "block";
+    // the visibility of existing documents is changed in the share dialog
+    privateLabel.style.display = state.key ? "none" : "flex";
+    passwordLabel.style.display = state.key ? "none" : "flex";
 }
 
 function updateFaviconStyle(matches) {
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+type (
+	BlameResponse struct {
+		Key     string      `json:"key"`
+		Version int64       `json:"version"`
+		File    string      `json:"file"`
+		Lines   []BlameLine `json:"lines"`
+	}
+
+	BlameLine struct {
+		Line        int    `json:"line"`
+		Version     int64  `json:"version"`
+		VersionTime string `json:"version_time"`
+		Message     string `json:"message,omitempty"`
+		Content     string `json:"content"`
+	}
+)
+
+// GetDocumentBlame annotates every line of a document file with the version which last changed it.
+func (s *Server) GetDocumentBlame(w http.ResponseWriter, r *http.Request) {
+	if err := checkUnscoped(r, chi.URLParam(r, "documentID")); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	document, err := s.getDocument(r, nil)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	file := document.Files[0]
+	if fileName := r.URL.Query().Get("file"); fileName != "" {
+		i := indexFile(document.Files, fileName)
+		if i == -1 {
+			s.error(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+			return
+		}
+		file = document.Files[i]
+	}
+
+	lines, err := s.blameFile(r, file)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, BlameResponse{
+		Key:     document.ID,
+		Version: file.DocumentVersion,
+		File:    file.Name,
+		Lines:   lines,
+	})
+}
+
+// blameFile walks the version chain of the file up to its version and returns for each line the version which last changed it.
+// Versions in which the file did not exist count as empty file, so a re-added file is blamed on the version which re-added it.
+func (s *Server) blameFile(r *http.Request, file database.File) ([]BlameLine, error) {
+	versions, err := s.db.GetDocumentVersions(r.Context(), file.DocumentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document versions: %w", err)
+	}
+	fileVersions, err := s.db.GetDocumentFileVersions(r.Context(), file.DocumentID, file.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make(map[int64]string, len(fileVersions))
+	for _, fileVersion := range fileVersions {
+		contents[fileVersion.DocumentVersion] = fileVersion.Content
+	}
+
+	// versions are ordered from newest to oldest
+	versions = slices.DeleteFunc(versions, func(version database.DocumentVersion) bool {
+		return version.Version > file.DocumentVersion
+	})
+	slices.Reverse(versions)
+
+	texts := make([]string, len(versions))
+	for i, version := range versions {
+		texts[i] = contents[version.Version]
+	}
+
+	blames := diff.Blame(texts)
+	lines := make([]BlameLine, len(blames))
+	for i, line := range diff.Lines(file.Content) {
+		version := versions[blames[i]]
+		lines[i] = BlameLine{
+			Line:        i + 1,
+			Version:     version.Version,
+			VersionTime: time.UnixMilli(version.Version).Format(VersionTimeFormat),
+			Message:     version.Message,
+			Content:     strings.TrimSuffix(line, "\n"),
+		}
+	}
+	return lines, nil
+}
@@ -42,17 +42,39 @@ func defaultConfig() Config {
 		CustomStyles:     "",
 		DefaultStyle:     "onedark",
 		Database: database.Config{
-			Type:            database.TypeSQLite,
-			Debug:           false,
-			ExpireAfter:     0,
-			CleanupInterval: timex.Duration(time.Minute),
-			Path:            "gobin.db",
-			Host:            "localhost",
-			Port:            5432,
-			Username:        "gobin",
-			Password:        "",
-			Database:        "gobin",
-			SSLMode:         "disable",
+			Type:              database.TypeSQLite,
+			Debug:             false,
+			ExpireAfter:       0,
+			CleanupInterval:   timex.Duration(time.Minute),
+			KeepVersions:      0,
+			KeepVersionsFor:   0,
+			DeleteGracePeriod: 0,
+			Compression:       database.CompressionNone,
+			ObjectStore: database.ObjectStoreConfig{
+				Enabled:  false,
+				Endpoint: "localhost:9000",
+				Region:   "",
+				Bucket:   "gobin",
+				Prefix:   "",
+				UseSSL:   false,
+				MinSize:  4096,
+			},
+			Backup: database.BackupConfig{
+				Enabled:    false,
+				Interval:   timex.Duration(time.Hour),
+				Target:     database.BackupTargetDir,
+				Dir:        "backups",
+				Prefix:     "backups/",
+				KeepHourly: 24,
+				KeepDaily:  7,
+			},
+			Path:     "gobin.db",
+			Host:     "localhost",
+			Port:     5432,
+			Username: "gobin",
+			Password: "",
+			Database: "gobin",
+			SSLMode:  "disable",
 		},
 		Log: LogConfig{
 			Level:     slog.LevelInfo,
@@ -67,6 +89,13 @@ func defaultConfig() Config {
 			Whitelist: []string{"127.0.0.1"},
 			Blacklist: nil,
 		},
+		Password: PasswordConfig{
+			Attempts:          5,
+			DocumentAttempts:  100,
+			AttemptsDuration:  timex.Duration(15 * time.Minute),
+			TrustProxyHeaders: false,
+			UnlockDuration:    timex.Duration(time.Hour),
+		},
 		Preview: PreviewConfig{
 			Enabled:      false,
 			InkscapePath: "inkscape",
@@ -111,13 +140,14 @@ type Config struct {
 	Log              LogConfig       `toml:"log"`
 	Database         database.Config `toml:"database"`
 	RateLimit        RateLimitConfig `toml:"rate_limit"`
+	Password         PasswordConfig  `toml:"password"`
 	Preview          PreviewConfig   `toml:"preview"`
 	Otel             OtelConfig      `toml:"otel"`
 	Webhook          WebhookConfig   `toml:"webhook"`
 }
 
 func (c Config) String() string {
-	return fmt.Sprintf("Debug: %t\nDevMode: %t\nListenAddr: %s\nHTTPTimeout: %s\nJWTSecret: %s\nMaxDocumentSize: %d\nMaxHighlightSize: %d\nCustomStyles: %s\nDefaultStyle: %s\nLog: %s\nDatabase: %s\nRateLimit: %s\nPreview: %s\nOtel: %s\nWebhook: %s",
+	return fmt.Sprintf("Debug: %t\nDevMode: %t\nListenAddr: %s\nHTTPTimeout: %s\nJWTSecret: %s\nMaxDocumentSize: %d\nMaxHighlightSize: %d\nCustomStyles: %s\nDefaultStyle: %s\nLog: %s\nDatabase: %s\nRateLimit: %s\nPassword: %s\nPreview: %s\nOtel: %s\nWebhook: %s",
 		c.Debug,
 		c.DevMode,
 		c.ListenAddr,
@@ -130,6 +160,7 @@ func (c Config) String() string {
 		c.Log,
 		c.Database,
 		c.RateLimit,
+		c.Password,
 		c.Preview,
 		c.Otel,
 		c.Webhook,
@@ -177,6 +208,29 @@ func (c RateLimitConfig) String() string {
 	)
 }
 
+// PasswordConfig configures password protected documents.
+type PasswordConfig struct {
+	// Attempts is how many unlock attempts are allowed per IP and document within AttemptsDuration
+	Attempts int `toml:"attempts"`
+	// DocumentAttempts is how many unlock attempts are allowed per document from all IPs within AttemptsDuration
+	DocumentAttempts int            `toml:"document_attempts"`
+	AttemptsDuration timex.Duration `toml:"attempts_duration"`
+	UnlockDuration   timex.Duration `toml:"unlock_duration"`
+	// TrustProxyHeaders limits unlock attempts by the IP in the X-Forwarded-For or X-Real-IP header instead of the connection,
+	// only enable it behind a proxy which sets these headers
+	TrustProxyHeaders bool `toml:"trust_proxy_headers"`
+}
+
+func (c PasswordConfig) String() string {
+	return fmt.Sprintf("\n Attempts: %d\n DocumentAttempts: %d\n AttemptsDuration: %s\n UnlockDuration: %s\n TrustProxyHeaders: %t",
+		c.Attempts,
+		c.DocumentAttempts,
+		time.Duration(c.AttemptsDuration),
+		time.Duration(c.UnlockDuration),
+		c.TrustProxyHeaders,
+	)
+}
+
 type PreviewConfig struct {
 	Enabled      bool           `toml:"enabled"`
 	InkscapePath string         `toml:"inkscape_path"`
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"archive/tar"
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	backupFormatVersion = 1
+	backupManifestName  = "manifest.json"
+	backupTablesDir     = "tables/"
+	// backupRestoreBatchSize is the number of rows inserted at once while restoring a backup
+	backupRestoreBatchSize = 500
+)
+
+var (
+	ErrInvalidBackup        = errors.New("invalid backup")
+	ErrBackupSchemaMismatch = errors.New("backup schema version does not match the database schema version")
+)
+
+// BackupManifest describes a backup archive, it is the first file in the archive.
+type BackupManifest struct {
+	FormatVersion int                `json:"format_version"`
+	SchemaVersion int                `json:"schema_version"`
+	GobinVersion  string             `json:"gobin_version"`
+	DatabaseType  Type               `json:"database_type"`
+	CreatedAt     time.Time          `json:"created_at"`
+	Tables        []TransferChecksum `json:"tables"`
+}
+
+// Backup writes a zstd compressed tar archive with a manifest and all rows of all tables as JSON lines to w.
+// All tables are read in one read only transaction, so the backup is a consistent snapshot.
+// File contents stored in the object store are included, so the backup can be restored without it.
+func Backup(ctx context.Context, db DB, w io.Writer, gobinVersion string) (*BackupManifest, error) {
+	dbx, dbType, err := sqlxOf(db)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkTransferTables(ctx, dbx, dbType); err != nil {
+		return nil, err
+	}
+
+	tx, err := dbx.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	manifest := BackupManifest{
+		FormatVersion: backupFormatVersion,
+		GobinVersion:  gobinVersion,
+		DatabaseType:  dbType,
+		CreatedAt:     time.Now().UTC(),
+	}
+	if manifest.SchemaVersion, err = schemaVersionOf(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	// tar needs the size of a file before its content, so the tables are written to temporary files first
+	tableFiles := make([]*os.File, 0, len(transferTables))
+	defer func() {
+		for _, file := range tableFiles {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
+	for _, table := range transferTables {
+		file, err := os.CreateTemp("", "gobin-backup-"+table.Name+"-*.jsonl")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		tableFiles = append(tableFiles, file)
+
+		checksum, err := backupTable(ctx, tx, blobStorageOf(db), table.Name, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to backup table %s: %w", table.Name, err)
+		}
+		manifest.Tables = append(manifest.Tables, checksum)
+	}
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+	}
+	tw := tar.NewWriter(zw)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0o644,
+		Size:    int64(len(manifestData)),
+		ModTime: manifest.CreatedAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if _, err = tw.Write(manifestData); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	for i, file := range tableFiles {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat temporary file: %w", err)
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("failed to seek temporary file: %w", err)
+		}
+		if err = tw.WriteHeader(&tar.Header{
+			Name:    backupTablesDir + transferTables[i].Name + ".jsonl",
+			Mode:    0o644,
+			Size:    info.Size(),
+			ModTime: manifest.CreatedAt,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to write table %s: %w", transferTables[i].Name, err)
+		}
+		if _, err = io.Copy(tw, file); err != nil {
+			return nil, fmt.Errorf("failed to write table %s: %w", transferTables[i].Name, err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close tar writer: %w", err)
+	}
+	if err = zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zstd writer: %w", err)
+	}
+	return &manifest, nil
+}
+
+func backupTable(ctx context.Context, tx *sqlx.Tx, blobs blobStorage, table string, w io.Writer) (TransferChecksum, error) {
+	checksum := TransferChecksum{Table: table}
+
+	kinds, err := columnKindsOf(ctx, tx, table)
+	if err != nil {
+		return checksum, err
+	}
+
+	rows, err := tx.QueryxContext(ctx, "SELECT * FROM "+table+";")
+	if err != nil {
+		return checksum, fmt.Errorf("failed to read rows: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for rows.Next() {
+		row := make(map[string]any)
+		if err = rows.MapScan(row); err != nil {
+			return checksum, fmt.Errorf("failed to scan row: %w", err)
+		}
+		for column, value := range row {
+			row[column] = transferValue(value, kinds[column])
+		}
+		if table == "blobs" && row["external"] == true {
+			if blobs.store == nil {
+				return checksum, fmt.Errorf("blob %s is stored in the object store, but no object store is configured", row["hash"])
+			}
+			data, err := blobs.store.Get(ctx, fmt.Sprint(row["hash"]))
+			if err != nil {
+				return checksum, fmt.Errorf("failed to get blob %s: %w", row["hash"], err)
+			}
+			row["content"] = data
+			row["external"] = false
+		}
+
+		checksum.add(row)
+		if err = enc.Encode(row); err != nil {
+			return checksum, fmt.Errorf("failed to encode row: %w", err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return checksum, fmt.Errorf("failed to read rows: %w", err)
+	}
+	if err = bw.Flush(); err != nil {
+		return checksum, fmt.Errorf("failed to write rows: %w", err)
+	}
+	return checksum, nil
+}
+
+// Restore restores a backup written by Backup into an empty database of any type.
+// The backup has to be of the same schema version as the database. All rows are inserted in one transaction,
+// which is only committed if the row counts and checksums of all tables match the manifest.
+func Restore(ctx context.Context, db DB, r io.Reader) (*BackupManifest, error) {
+	dbx, _, err := sqlxOf(db)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read manifest: %w", ErrInvalidBackup, err)
+	}
+	if header.Name != backupManifestName {
+		return nil, fmt.Errorf("%w: first file is %s instead of %s", ErrInvalidBackup, header.Name, backupManifestName)
+	}
+	var manifest BackupManifest
+	if err = json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode manifest: %w", ErrInvalidBackup, err)
+	}
+	if manifest.FormatVersion != backupFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidBackup, manifest.FormatVersion)
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	schemaVersion, err := schemaVersionOf(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion != schemaVersion {
+		return nil, fmt.Errorf("%w: backup has version %d, database has version %d", ErrBackupSchemaMismatch, manifest.SchemaVersion, schemaVersion)
+	}
+	if err = checkTransferEmpty(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	for {
+		header, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read file: %w", ErrInvalidBackup, err)
+		}
+
+		table, ok := strings.CutSuffix(strings.TrimPrefix(header.Name, backupTablesDir), ".jsonl")
+		if !ok || !slices.ContainsFunc(transferTables, func(t transferTable) bool {
+			return t.Name == table
+		}) {
+			return nil, fmt.Errorf("%w: unknown file %s", ErrInvalidBackup, header.Name)
+		}
+		if err = restoreTable(ctx, tx, table, tr); err != nil {
+			return nil, fmt.Errorf("failed to restore table %s: %w", table, err)
+		}
+	}
+
+	for _, expected := range manifest.Tables {
+		checksum, err := checksumTable(ctx, tx, expected.Table)
+		if err != nil {
+			return nil, err
+		}
+		if checksum.Rows != expected.Rows {
+			return nil, fmt.Errorf("table %s has %d rows but the backup has %d rows", expected.Table, checksum.Rows, expected.Rows)
+		}
+		if checksum.Checksum != expected.Checksum {
+			return nil, fmt.Errorf("table %s has checksum %x but the backup has checksum %x", expected.Table, checksum.Checksum, expected.Checksum)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return &manifest, nil
+}
+
+func restoreTable(ctx context.Context, tx *sqlx.Tx, table string, r io.Reader) error {
+	kinds, err := columnKindsOf(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	batch := make([]map[string]any, 0, backupRestoreBatchSize)
+	for {
+		var row map[string]any
+		if err = dec.Decode(&row); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: failed to decode row: %w", ErrInvalidBackup, err)
+		}
+		for column, value := range row {
+			if row[column], err = restoreValue(value, kinds[column]); err != nil {
+				return fmt.Errorf("%w: invalid value of column %s: %w", ErrInvalidBackup, column, err)
+			}
+		}
+
+		batch = append(batch, row)
+		if len(batch) == backupRestoreBatchSize {
+			if err = insertTransferRows(ctx, tx, table, kinds, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return insertTransferRows(ctx, tx, table, kinds, batch)
+}
+
+// restoreValue converts a value decoded from JSON to the value stored in a column of the kind.
+func restoreValue(value any, kind columnKind) (any, error) {
+	switch v := value.(type) {
+	case string:
+		switch kind {
+		case columnKindBytes:
+			return base64.StdEncoding.DecodeString(v)
+		case columnKindTime:
+			return time.Parse(time.RFC3339Nano, v)
+		}
+		return v, nil
+	case json.Number:
+		if kind == columnKindBool {
+			return v.String() != "0", nil
+		}
+		return v.Int64()
+	}
+	return value, nil
+}
+
+// schemaVersionOf returns the version of the last migration applied by gomigrate.
+func schemaVersionOf(ctx context.Context, q sqlx.QueryerContext) (int, error) {
+	var version int
+	if err := sqlx.GetContext(ctx, q, &version, "SELECT COALESCE(MAX(version), 0) FROM gomigrate;"); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+func blobStorageOf(db DB) blobStorage {
+	switch d := db.(type) {
+	case *postgresDB:
+		return d.blobs
+	case *sqliteDB:
+		return d.blobs
+	default:
+		return blobStorage{}
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	from, _ := newTestContentStoreDB(t)
+
+	documentID, version, err := from.CreateDocument(ctx, []File{
+		{Name: "a.txt", Content: "external", OrderIndex: 0},
+		{Name: "b.txt", Content: "b", OrderIndex: 1},
+	}, DocumentAccess{Visibility: "public"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+
+	var external int
+	if err = from.(*sqliteDB).GetContext(ctx, &external, "SELECT COUNT(*) FROM blobs WHERE external;"); err != nil {
+		t.Fatalf("failed to count external blobs: %s", err)
+	}
+	if external != 2 {
+		t.Fatalf("external blobs = %d, want 2", external)
+	}
+
+	var backup bytes.Buffer
+	manifest, err := Backup(ctx, from, &backup, "test")
+	if err != nil {
+		t.Fatalf("failed to backup database: %s", err)
+	}
+
+	// the contents of the object store are restored into the database
+	to := newTestDB(t, Config{})
+	restored, err := Restore(ctx, to, bytes.NewReader(backup.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to restore backup: %s", err)
+	}
+	if restored.SchemaVersion != manifest.SchemaVersion {
+		t.Errorf("schema version = %d, want %d", restored.SchemaVersion, manifest.SchemaVersion)
+	}
+
+	files, err := to.GetDocumentVersion(ctx, *documentID, *version)
+	if err != nil {
+		t.Fatalf("failed to get document: %s", err)
+	}
+	if len(files) != 2 || files[0].Content != "external" || files[1].Content != "b" {
+		t.Errorf("files = %+v, want the contents external and b", files)
+	}
+
+	if err = to.(*sqliteDB).GetContext(ctx, &external, "SELECT COUNT(*) FROM blobs WHERE external;"); err != nil {
+		t.Fatalf("failed to count external blobs: %s", err)
+	}
+	if external != 0 {
+		t.Errorf("external blobs = %d, want 0", external)
+	}
+}
+
+func TestRestoreSchemaMismatch(t *testing.T) {
+	ctx := context.Background()
+	from := newTestDB(t, Config{})
+
+	if _, _, err := from.CreateDocument(ctx, []File{{Name: "a.txt", Content: "a"}}, DocumentAccess{Visibility: "public"}, nil); err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+
+	var backup bytes.Buffer
+	if _, err := Backup(ctx, from, &backup, "test"); err != nil {
+		t.Fatalf("failed to backup database: %s", err)
+	}
+
+	// a database migrated further than the backup
+	to := newTestDB(t, Config{})
+	if _, err := to.(*sqliteDB).ExecContext(ctx, "INSERT INTO gomigrate (version) SELECT MAX(version) + 1 FROM gomigrate;"); err != nil {
+		t.Fatalf("failed to bump schema version: %s", err)
+	}
+
+	if _, err := Restore(ctx, to, bytes.NewReader(backup.Bytes())); !errors.Is(err, ErrBackupSchemaMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrBackupSchemaMismatch)
+	}
+
+	var documents int
+	if err := to.(*sqliteDB).GetContext(ctx, &documents, "SELECT COUNT(*) FROM documents;"); err != nil {
+		t.Fatalf("failed to count documents: %s", err)
+	}
+	if documents != 0 {
+		t.Errorf("documents = %d, want 0", documents)
+	}
+}
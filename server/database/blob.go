@@ -0,0 +1,448 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+)
+
+func init() {
+	// sqlite has no built-in sha256 function, the blob migration needs it to hash existing file contents
+	sqlite.MustRegisterDeterministicScalarFunction("sha256_hex", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch content := args[0].(type) {
+		case string:
+			return contentHash(content), nil
+		case []byte:
+			return contentHash(string(content)), nil
+		default:
+			return nil, fmt.Errorf("sha256_hex: unsupported argument type %T", args[0])
+		}
+	})
+}
+
+// blobSnapshotInterval is the maximum length of a delta chain, after it the full content is stored again to bound the cost of rebuilding it.
+const blobSnapshotInterval = 16
+
+// Blob is the content of one or more files, it is stored once per distinct content and referenced by its SHA-256 hash.
+// If BaseHash is set Content is a delta against the content of the base blob, Depth is the number of deltas to the next full content.
+// Content is stored compressed with Compression, see compress, either in the database or in the ContentStore.
+type Blob struct {
+	Hash        string      `db:"hash"`
+	Content     []byte      `db:"content"`
+	Compression Compression `db:"compression"`
+	BaseHash    string      `db:"base_hash"`
+	Depth       int         `db:"depth"`
+	Size        int         `db:"size"`
+	Lines       int         `db:"lines"`
+	RefCount    int         `db:"ref_count"`
+	// External is set if Content is stored in the ContentStore instead of the database
+	External bool `db:"external"`
+}
+
+// contentHash returns the hex encoded SHA-256 hash of the content.
+func contentHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
+
+// countLines returns the number of lines of the content, the trailing line is counted even if it doesn't end with a newline.
+func countLines(content string) int {
+	lines := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	return lines
+}
+
+// blobStorage stores the content of blobs compressed in the database or in the content store if it is set and the content is at least minSize bytes.
+type blobStorage struct {
+	compression Compression
+	store       ContentStore
+	minSize     int
+}
+
+// externalContent clears the compressed content of the blob in the database and returns it if it is large enough for the content store.
+func (b blobStorage) externalContent(blob *Blob) []byte {
+	if b.store == nil || len(blob.Content) < b.minSize {
+		blob.External = false
+		return nil
+	}
+	data := blob.Content
+	blob.Content = []byte{}
+	blob.External = true
+	return data
+}
+
+// storeContent stores the compressed content of the blob in the content store if it is large enough and clears it in the database.
+func (b blobStorage) storeContent(ctx context.Context, blob *Blob) error {
+	data := b.externalContent(blob)
+	if data == nil {
+		return nil
+	}
+	if err := b.store.Put(ctx, blob.Hash, data); err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", blob.Hash, err)
+	}
+	return nil
+}
+
+// insertFiles stores the content of the files as blobs and inserts the files referencing them.
+// New content is stored as delta against the previous version of the file if that is smaller than the full content.
+// Blobs inserted by a concurrent transaction in the meantime are referenced instead.
+// It returns the hashes of the blobs it stored in the content store, even if it fails. If the transaction is rolled back
+// they have to be deleted with deleteContents, as no committed blob references them.
+func (b blobStorage) insertFiles(ctx context.Context, tx *sqlx.Tx, files []File) ([]string, error) {
+	var stored []string
+	loader := b.newLoader(tx)
+	for i, file := range files {
+		files[i].ContentHash = contentHash(file.Content)
+
+		res, err := tx.ExecContext(ctx, "UPDATE blobs SET ref_count = ref_count + 1 WHERE hash = $1;", files[i].ContentHash)
+		if err != nil {
+			return stored, fmt.Errorf("failed to reference blob: %w", err)
+		}
+		if rows, err := res.RowsAffected(); err != nil {
+			return stored, err
+		} else if rows > 0 {
+			continue
+		}
+
+		content := file.Content
+		blob := Blob{
+			Hash:     files[i].ContentHash,
+			Size:     len(file.Content),
+			Lines:    countLines(file.Content),
+			RefCount: 1,
+		}
+
+		var base Blob
+		if err = tx.GetContext(ctx, &base, "SELECT b.hash, b.depth FROM files f JOIN blobs b ON b.hash = f.content_hash WHERE f.document_id = $1 AND f.name = $2 ORDER BY f.document_version DESC LIMIT 1;", file.DocumentID, file.Name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return stored, fmt.Errorf("failed to get base blob: %w", err)
+		}
+		if base.Hash != "" && base.Depth+1 < blobSnapshotInterval {
+			baseContent, err := loader.load(ctx, base.Hash)
+			if err != nil {
+				return stored, err
+			}
+			if delta := diff.Delta(baseContent, file.Content); len(delta) < len(file.Content) {
+				content = delta
+				blob.BaseHash = base.Hash
+				blob.Depth = base.Depth + 1
+			}
+		}
+
+		if blob.Content, err = compress(content, b.compression); err != nil {
+			return stored, err
+		}
+		blob.Compression = b.compression
+		data := b.externalContent(&blob)
+		query, args, err := tx.BindNamed("INSERT INTO blobs (hash, content, compression, base_hash, depth, size, lines, ref_count, external) VALUES (:hash, :content, :compression, :base_hash, :depth, :size, :lines, :ref_count, :external) ON CONFLICT (hash) DO UPDATE SET ref_count = blobs.ref_count + 1 RETURNING ref_count;", blob)
+		if err != nil {
+			return stored, fmt.Errorf("failed to bind blob: %w", err)
+		}
+		var refCount int
+		if err = tx.GetContext(ctx, &refCount, query, args...); err != nil {
+			return stored, fmt.Errorf("failed to insert blob: %w", err)
+		}
+		// only a newly inserted blob references its base and stores its content, otherwise the existing blob was referenced
+		if refCount > 1 {
+			continue
+		}
+		if blob.BaseHash != "" {
+			if _, err = tx.ExecContext(ctx, "UPDATE blobs SET ref_count = ref_count + 1 WHERE hash = $1;", blob.BaseHash); err != nil {
+				return stored, fmt.Errorf("failed to reference base blob: %w", err)
+			}
+		}
+		if data != nil {
+			// a failed put may still have stored the object
+			stored = append(stored, blob.Hash)
+			if err = b.store.Put(ctx, blob.Hash, data); err != nil {
+				return stored, fmt.Errorf("failed to store blob %s: %w", blob.Hash, err)
+			}
+		}
+	}
+
+	if _, err := tx.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content_hash, language, expires_at, order_index) VALUES (:name, :document_id, :document_version, :content_hash, :language, :expires_at, :order_index);", files); err != nil {
+		return stored, fmt.Errorf("failed to insert files: %w", err)
+	}
+	return stored, nil
+}
+
+// loadFiles sets the content of the files from the blobs they reference.
+func (b blobStorage) loadFiles(ctx context.Context, q sqlx.QueryerContext, files []File) error {
+	return b.newLoader(q).loadFiles(ctx, files)
+}
+
+// release drops the references of the deleted files and deletes all blobs which are no longer referenced.
+// Deleting a delta blob releases its base blob. It returns the hashes of deleted blobs which are stored in the content store,
+// they have to be deleted with deleteContents after the transaction is committed.
+func (b blobStorage) release(ctx context.Context, tx *sqlx.Tx, files []File) ([]string, error) {
+	refs := make(map[string]int)
+	for _, file := range files {
+		refs[file.ContentHash]++
+	}
+
+	var external []string
+	for hash, count := range refs {
+		for hash != "" {
+			var blob Blob
+			if err := tx.GetContext(ctx, &blob, "UPDATE blobs SET ref_count = ref_count - $1 WHERE hash = $2 RETURNING base_hash, ref_count, external;", count, hash); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					break
+				}
+				return nil, fmt.Errorf("failed to release blob: %w", err)
+			}
+			if blob.RefCount > 0 {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, "DELETE FROM blobs WHERE hash = $1;", hash); err != nil {
+				return nil, fmt.Errorf("failed to delete orphaned blob: %w", err)
+			}
+			if blob.External {
+				external = append(external, hash)
+			}
+			hash, count = blob.BaseHash, 1
+		}
+	}
+	return external, nil
+}
+
+// deleteContents deletes the content of released blobs from the content store.
+// Blobs which have been stored again in the meantime are skipped, objects which fail to delete are only logged as they are not referenced anymore.
+func (b blobStorage) deleteContents(ctx context.Context, q sqlx.QueryerContext, hashes []string) {
+	if b.store == nil {
+		if len(hashes) > 0 {
+			slog.WarnContext(ctx, "released blobs are stored in the object store, but no object store is configured", slog.Int("count", len(hashes)))
+		}
+		return
+	}
+	for _, hash := range hashes {
+		var exists bool
+		if err := sqlx.GetContext(ctx, q, &exists, "SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = $1);", hash); err != nil {
+			slog.ErrorContext(ctx, "failed to check released blob", slog.String("hash", hash), slog.Any("err", err))
+			continue
+		}
+		if exists {
+			continue
+		}
+		if err := b.store.Delete(ctx, hash); err != nil {
+			slog.ErrorContext(ctx, "failed to delete released blob from content store", slog.String("hash", hash), slog.Any("err", err))
+		}
+	}
+}
+
+// deleteUnreferencedContents deletes the objects of the content store which no blob references and which were modified before the time.
+// They are left behind if deleting the contents of released or rolled back blobs failed. Newer objects are kept,
+// as their blobs may be inserted by a transaction which isn't committed yet. It returns the number of deleted objects.
+func (b blobStorage) deleteUnreferencedContents(ctx context.Context, q sqlx.QueryerContext, before time.Time) (int, error) {
+	if b.store == nil {
+		return 0, nil
+	}
+
+	var count int
+	err := b.store.List(ctx, func(key string, modified time.Time) error {
+		// the bucket may be shared, only objects named like blobs are deleted
+		if !isContentHash(key) || !modified.Before(before) {
+			return nil
+		}
+		var exists bool
+		if err := sqlx.GetContext(ctx, q, &exists, "SELECT EXISTS (SELECT 1 FROM blobs WHERE hash = $1 AND external);", key); err != nil {
+			return fmt.Errorf("failed to check blob %s: %w", key, err)
+		}
+		if exists {
+			return nil
+		}
+		if err := b.store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete blob %s from content store: %w", key, err)
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// isContentHash reports whether the key is a hash returned by contentHash.
+func isContentHash(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// migrate re-compresses up to limit blobs after the hash which are not stored with the compression and moves them to or from the content store.
+// It returns the hash of the last checked blob, which is empty if there are no more blobs, and the number of migrated blobs.
+func (b blobStorage) migrate(ctx context.Context, db *sqlx.DB, after string, limit int) (string, int, error) {
+	var blobs []Blob
+	if err := db.SelectContext(ctx, &blobs, "SELECT hash, content, compression, external FROM blobs WHERE hash > $1 ORDER BY hash LIMIT $2;", after, limit); err != nil {
+		return "", 0, fmt.Errorf("failed to get blobs: %w", err)
+	}
+	if len(blobs) == 0 {
+		return "", 0, nil
+	}
+
+	var count int
+	for _, blob := range blobs {
+		wasExternal := blob.External
+		if blob.External {
+			if b.store == nil {
+				return "", 0, fmt.Errorf("blob %s is stored in the object store, but no object store is configured", blob.Hash)
+			}
+			data, err := b.store.Get(ctx, blob.Hash)
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to get blob %s: %w", blob.Hash, err)
+			}
+			blob.Content = data
+		}
+
+		if blob.Compression != b.compression {
+			content, err := decompress(blob.Content, blob.Compression)
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to decompress blob %s: %w", blob.Hash, err)
+			}
+			if blob.Content, err = compress(content, b.compression); err != nil {
+				return "", 0, err
+			}
+			blob.Compression = b.compression
+		} else if wasExternal == (b.store != nil && len(blob.Content) >= b.minSize) {
+			continue
+		}
+
+		if err := b.storeContent(ctx, &blob); err != nil {
+			return "", 0, err
+		}
+		if _, err := db.ExecContext(ctx, "UPDATE blobs SET content = $1, compression = $2, external = $3 WHERE hash = $4;", blob.Content, blob.Compression, blob.External, blob.Hash); err != nil {
+			return "", 0, fmt.Errorf("failed to update blob %s: %w", blob.Hash, err)
+		}
+		if wasExternal && !blob.External {
+			if err := b.store.Delete(ctx, blob.Hash); err != nil {
+				return "", 0, fmt.Errorf("failed to delete blob %s from object store: %w", blob.Hash, err)
+			}
+		}
+		count++
+	}
+	return blobs[len(blobs)-1].Hash, count, nil
+}
+
+// inlineContents copies the contents of all blobs stored in the content store into the blobs of the SQLite database at the path.
+func (b blobStorage) inlineContents(ctx context.Context, path string) error {
+	db, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+
+	var hashes []string
+	if err = db.SelectContext(ctx, &hashes, "SELECT hash FROM blobs WHERE external;"); err != nil {
+		return fmt.Errorf("failed to get external blobs: %w", err)
+	}
+	if len(hashes) > 0 && b.store == nil {
+		return fmt.Errorf("%d blobs are stored in the object store, but no object store is configured", len(hashes))
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, hash := range hashes {
+		data, err := b.store.Get(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("failed to get blob %s: %w", hash, err)
+		}
+		if _, err = tx.ExecContext(ctx, "UPDATE blobs SET content = $1, external = false WHERE hash = $2;", data, hash); err != nil {
+			return fmt.Errorf("failed to update blob %s: %w", hash, err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// blobLoader rebuilds the content of blobs and caches it, so files sharing a delta chain only load every blob once.
+type blobLoader struct {
+	q        sqlx.QueryerContext
+	store    ContentStore
+	contents map[string]string
+}
+
+func (b blobStorage) newLoader(q sqlx.QueryerContext) *blobLoader {
+	return &blobLoader{
+		q:        q,
+		store:    b.store,
+		contents: make(map[string]string),
+	}
+}
+
+// load returns the full content of the blob with the hash by applying its delta chain.
+func (l *blobLoader) load(ctx context.Context, hash string) (string, error) {
+	var (
+		chain   []Blob
+		content string
+	)
+	for hash != "" {
+		if cached, ok := l.contents[hash]; ok {
+			content = cached
+			break
+		}
+		var blob Blob
+		if err := sqlx.GetContext(ctx, l.q, &blob, "SELECT hash, content, compression, base_hash, external FROM blobs WHERE hash = $1;", hash); err != nil {
+			return "", fmt.Errorf("failed to get blob: %w", err)
+		}
+		if blob.External {
+			if l.store == nil {
+				return "", fmt.Errorf("blob %s is stored in the object store, but no object store is configured", blob.Hash)
+			}
+			data, err := l.store.Get(ctx, blob.Hash)
+			if err != nil {
+				return "", fmt.Errorf("failed to get blob %s: %w", blob.Hash, err)
+			}
+			blob.Content = data
+		}
+		chain = append(chain, blob)
+		hash = blob.BaseHash
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		data, err := decompress(chain[i].Content, chain[i].Compression)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress blob %s: %w", chain[i].Hash, err)
+		}
+		if chain[i].BaseHash == "" {
+			content = data
+		} else if content, err = diff.ApplyDelta(content, data); err != nil {
+			return "", fmt.Errorf("failed to apply delta of blob %s: %w", chain[i].Hash, err)
+		}
+		l.contents[chain[i].Hash] = content
+	}
+	return content, nil
+}
+
+// loadFiles sets the content of the files from the blobs they reference.
+func (l *blobLoader) loadFiles(ctx context.Context, files []File) error {
+	for i, file := range files {
+		content, err := l.load(ctx, file.ContentHash)
+		if err != nil {
+			return err
+		}
+		files[i].Content = content
+	}
+	return nil
+}
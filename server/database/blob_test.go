@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestContentStoreDB(t *testing.T) (DB, ContentStore) {
+	t.Helper()
+	store := NewMemoryContentStore()
+	db, err := NewWithContentStore(context.Background(), Config{
+		Type: TypeSQLite,
+		Path: filepath.Join(t.TempDir(), "gobin.db"),
+	}, os.DirFS("../.."), store)
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db, store
+}
+
+func countObjects(t *testing.T, store ContentStore) int {
+	t.Helper()
+	var count int
+	if err := store.List(context.Background(), func(string, time.Time) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to list objects: %s", err)
+	}
+	return count
+}
+
+func TestInsertFilesRollback(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestContentStoreDB(t)
+
+	// the duplicate file name fails the transaction after the contents are stored
+	if _, _, err := db.CreateDocument(ctx, []File{
+		{Name: "test.txt", Content: "1"},
+		{Name: "test.txt", Content: "2"},
+	}, DocumentAccess{Visibility: "public"}, nil); err == nil {
+		t.Fatal("expected creating the document to fail")
+	}
+
+	if count := countObjects(t, store); count != 0 {
+		t.Errorf("objects = %d, want 0", count)
+	}
+}
+
+func TestDeleteUnreferencedContents(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestContentStoreDB(t)
+
+	if _, _, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: "referenced"}}, DocumentAccess{Visibility: "public"}, nil); err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+	for _, key := range []string{contentHash("unreferenced"), "snapshot.db"} {
+		if err := store.Put(ctx, key, []byte(key)); err != nil {
+			t.Fatalf("failed to put object: %s", err)
+		}
+	}
+
+	count, err := db.DeleteUnreferencedContents(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("failed to delete unreferenced contents: %s", err)
+	}
+	if count != 1 {
+		t.Errorf("deleted = %d, want 1", count)
+	}
+	if _, err = store.Get(ctx, contentHash("unreferenced")); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("unreferenced object: err = %v, want %v", err, ErrObjectNotFound)
+	}
+	if count = countObjects(t, store); count != 2 {
+		t.Errorf("objects = %d, want 2", count)
+	}
+}
+
+func TestBlobDeltaChain(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, Config{})
+
+	// a large content with a small change per version is stored as delta against the previous version
+	lines := make([]string, 100)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d\n", i)
+	}
+	content := func(version int) string {
+		changed := make([]string, len(lines))
+		copy(changed, lines)
+		changed[version%len(lines)] = fmt.Sprintf("version %d\n", version)
+		return strings.Join(changed, "")
+	}
+
+	documentID, version, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: content(0)}}, DocumentAccess{Visibility: "public"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+	versions := []int64{*version}
+	for i := 1; i < 2*blobSnapshotInterval+4; i++ {
+		// versions are unix milliseconds
+		time.Sleep(2 * time.Millisecond)
+		if version, err = db.UpdateDocument(ctx, *documentID, []File{{Name: "test.txt", Content: content(i)}}, *version); err != nil {
+			t.Fatalf("failed to update document: %s", err)
+		}
+		versions = append(versions, *version)
+	}
+
+	for i, version := range versions {
+		files, err := db.GetDocumentVersion(ctx, *documentID, version)
+		if err != nil {
+			t.Fatalf("failed to get version %d: %s", i, err)
+		}
+		if files[0].Content != content(i) {
+			t.Errorf("version %d: content = %q, want %q", i, files[0].Content, content(i))
+		}
+	}
+
+	var depths []int
+	if err = db.(*sqliteDB).SelectContext(ctx, &depths, "SELECT b.depth FROM files f JOIN blobs b ON b.hash = f.content_hash WHERE f.document_id = $1 ORDER BY f.document_version;", *documentID); err != nil {
+		t.Fatalf("failed to get blob depths: %s", err)
+	}
+	for i, depth := range depths {
+		// the full content is stored again once the chain reaches blobSnapshotInterval blobs
+		if want := i % blobSnapshotInterval; depth != want {
+			t.Errorf("version %d: depth = %d, want %d", i, depth, want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func (c Compression) Valid() bool {
+	switch c {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	}
+	return false
+}
+
+// compress compresses the content for storing it.
+func compress(content string, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionGzip:
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		if _, err := io.WriteString(w, content); err != nil {
+			return nil, fmt.Errorf("failed to gzip content: %w", err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip content: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll([]byte(content), nil), nil
+	default:
+		return []byte(content), nil
+	}
+}
+
+// decompress decompresses stored content with the compression it was stored with.
+func decompress(data []byte, compression Compression) (string, error) {
+	switch compression {
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to gunzip content: %w", err)
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("failed to gunzip content: %w", err)
+		}
+		return string(content), nil
+	case CompressionZstd:
+		content, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to decompress zstd content: %w", err)
+		}
+		return string(content), nil
+	default:
+		return string(data), nil
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	contents := []string{
+		"hello world\n",
+		"\x1f\x8b\x08 starts like gzip",
+		"\x28\xb5\x2f\xfd starts like zstd",
+	}
+
+	for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t, Config{Compression: compression})
+
+			for _, content := range contents {
+				documentID, _, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: content}}, DocumentAccess{Visibility: "public"}, nil)
+				if err != nil {
+					t.Fatalf("failed to create document: %s", err)
+				}
+
+				files, err := db.GetDocument(ctx, *documentID)
+				if err != nil {
+					t.Fatalf("failed to get document: %s", err)
+				}
+				if files[0].Content != content {
+					t.Errorf("content = %q, want %q", files[0].Content, content)
+				}
+			}
+		})
+	}
+}
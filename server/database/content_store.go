@@ -0,0 +1,210 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var ErrObjectNotFound = errors.New("object not found")
+
+type ObjectStoreConfig struct {
+	Enabled         bool   `toml:"enabled"`
+	Endpoint        string `toml:"endpoint"`
+	Region          string `toml:"region"`
+	Bucket          string `toml:"bucket"`
+	Prefix          string `toml:"prefix"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	UseSSL          bool   `toml:"use_ssl"`
+	MinSize         int    `toml:"min_size"`
+}
+
+func (c ObjectStoreConfig) String() string {
+	return fmt.Sprintf("\n   Enabled: %t\n   Endpoint: %s\n   Region: %s\n   Bucket: %s\n   Prefix: %s\n   AccessKeyID: %s\n   SecretAccessKey: %s\n   UseSSL: %t\n   MinSize: %d",
+		c.Enabled,
+		c.Endpoint,
+		c.Region,
+		c.Bucket,
+		c.Prefix,
+		c.AccessKeyID,
+		strings.Repeat("*", len(c.SecretAccessKey)),
+		c.UseSSL,
+		c.MinSize,
+	)
+}
+
+// ContentStore stores the content of blobs outside the database, objects are identified by the hash of their blob.
+type ContentStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns ErrObjectNotFound if there is no object for the key.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn with the key and the last modification of every object until fn returns an error.
+	List(ctx context.Context, fn func(key string, modified time.Time) error) error
+}
+
+var _ ContentStore = (*s3ContentStore)(nil)
+
+// NewS3ContentStore returns a ContentStore which stores objects in a bucket of an S3 compatible object storage like MinIO.
+func NewS3ContentStore(ctx context.Context, cfg ObjectStoreConfig) (ContentStore, error) {
+	client, err := newS3Client(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3ContentStore{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: cfg.Prefix,
+	}, nil
+}
+
+// newS3Client creates a client for the object storage and checks that the configured bucket exists.
+func newS3Client(ctx context.Context, cfg ObjectStoreConfig) (*minio.Client, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check object store bucket: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("object store bucket %q does not exist", cfg.Bucket)
+	}
+	return client, nil
+}
+
+type s3ContentStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3ContentStore) Put(ctx context.Context, key string, data []byte) error {
+	if _, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	}); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3ContentStore) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer func() {
+		_ = object.Close()
+	}()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, nil
+}
+
+func (s *s3ContentStore) Delete(ctx context.Context, key string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3ContentStore) List(ctx context.Context, fn func(key string, modified time.Time) error) error {
+	// canceling the context stops listing if fn returns early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: true,
+	}) {
+		if object.Err != nil {
+			return fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		if err := fn(strings.TrimPrefix(object.Key, s.prefix), object.LastModified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ ContentStore = (*memoryContentStore)(nil)
+
+// NewMemoryContentStore returns a ContentStore which keeps all objects in memory, it is meant for testing.
+func NewMemoryContentStore() ContentStore {
+	return &memoryContentStore{
+		objects: make(map[string]memoryObject),
+	}
+}
+
+type memoryContentStore struct {
+	mu      sync.Mutex
+	objects map[string]memoryObject
+}
+
+type memoryObject struct {
+	data     []byte
+	modified time.Time
+}
+
+func (s *memoryContentStore) Put(_ context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = memoryObject{
+		data:     bytes.Clone(data),
+		modified: time.Now(),
+	}
+	return nil
+}
+
+func (s *memoryContentStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+	return bytes.Clone(object.data), nil
+}
+
+func (s *memoryContentStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *memoryContentStore) List(_ context.Context, fn func(key string, modified time.Time) error) error {
+	s.mu.Lock()
+	objects := maps.Clone(s.objects)
+	s.mu.Unlock()
+
+	for key, object := range objects {
+		if err := fn(key, object.modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -39,10 +39,16 @@ const (
 )
 
 type Config struct {
-	Type            Type           `toml:"type"`
-	Debug           bool           `toml:"debug"`
-	ExpireAfter     timex.Duration `toml:"expire_after"`
-	CleanupInterval timex.Duration `toml:"cleanup_interval"`
+	Type              Type              `toml:"type"`
+	Debug             bool              `toml:"debug"`
+	ExpireAfter       timex.Duration    `toml:"expire_after"`
+	CleanupInterval   timex.Duration    `toml:"cleanup_interval"`
+	KeepVersions      int               `toml:"keep_versions"`
+	KeepVersionsFor   timex.Duration    `toml:"keep_versions_for"`
+	DeleteGracePeriod timex.Duration    `toml:"delete_grace_period"`
+	Compression       Compression       `toml:"compression"`
+	ObjectStore       ObjectStoreConfig `toml:"object_store"`
+	Backup            BackupConfig      `toml:"backup"`
 
 	// SQLite
 	Path string `toml:"path"`
@@ -57,11 +63,17 @@ type Config struct {
 }
 
 func (c Config) String() string {
-	str := fmt.Sprintf("\n  Type: %s\n  Debug: %t\n  ExpireAfter: %s\n  CleanupInterval: %s\n  ",
+	str := fmt.Sprintf("\n  Type: %s\n  Debug: %t\n  ExpireAfter: %s\n  CleanupInterval: %s\n  KeepVersions: %d\n  KeepVersionsFor: %s\n  DeleteGracePeriod: %s\n  Compression: %s\n  ObjectStore: %s\n  Backup: %s\n  ",
 		c.Type,
 		c.Debug,
 		time.Duration(c.ExpireAfter),
 		time.Duration(c.CleanupInterval),
+		c.KeepVersions,
+		time.Duration(c.KeepVersionsFor),
+		time.Duration(c.DeleteGracePeriod),
+		c.Compression,
+		c.ObjectStore,
+		c.Backup,
 	)
 	switch c.Type {
 	case TypePostgres:
@@ -92,7 +104,29 @@ func (c Config) PostgresDataSourceName() string {
 	)
 }
 
+// New opens the configured database and runs the migrations.
+// If the object store is enabled, file contents are stored in the configured S3 compatible bucket.
 func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
+	var store ContentStore
+	if cfg.ObjectStore.Enabled {
+		var err error
+		if store, err = NewS3ContentStore(ctx, cfg.ObjectStore); err != nil {
+			return nil, err
+		}
+	}
+	return NewWithContentStore(ctx, cfg, migrations, store)
+}
+
+// NewWithContentStore opens the configured database like New, but stores file contents in the given ContentStore instead of the configured object store.
+// The store may be nil to keep all file contents in the database.
+func NewWithContentStore(ctx context.Context, cfg Config, migrations fs.FS, store ContentStore) (DB, error) {
+	if cfg.Compression == "" {
+		cfg.Compression = CompressionNone
+	}
+	if !cfg.Compression.Valid() {
+		return nil, errors.New("invalid database compression, must be one of: none, gzip, zstd")
+	}
+
 	var (
 		driverName      string
 		dataSourceName  string
@@ -123,12 +157,12 @@ func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
 		}
 		dataSourceName = stdlib.RegisterConnConfig(pgCfg)
 	case TypeSQLite:
-		driverName = "sqliteDB"
+		driverName = "sqlite"
 		dbSystem = semconv.DBSystemSqlite
 		dataSourceName = cfg.Path
 		migrationDriver = sqlite.New
 	default:
-		return nil, errors.New("invalid database type, must be one of: postgresDB, sqliteDB")
+		return nil, errors.New("invalid database type, must be one of: postgres, sqlite")
 	}
 
 	sqlDB, err := otelsql.Open(driverName, dataSourceName,
@@ -158,13 +192,18 @@ func New(ctx context.Context, cfg Config, migrations fs.FS) (DB, error) {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	blobs := blobStorage{
+		compression: cfg.Compression,
+		store:       store,
+		minSize:     cfg.ObjectStore.MinSize,
+	}
 	switch cfg.Type {
 	case TypePostgres:
-		return newPostgresDB(dbx), nil
+		return newPostgresDB(dbx, blobs), nil
 	case TypeSQLite:
-		return newSQLiteDB(dbx), nil
+		return newSQLiteDB(dbx, blobs), nil
 	default:
-		return nil, errors.New("invalid database type, must be one of: postgresDB, sqliteDB")
+		return nil, errors.New("invalid database type, must be one of: postgres, sqlite")
 	}
 }
 
@@ -174,20 +213,48 @@ type DB interface {
 	GetDocument(ctx context.Context, documentID string) ([]File, error)
 	GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error)
 	GetVersionCount(ctx context.Context, documentID string) (int, error)
-	GetDocumentVersions(ctx context.Context, documentID string) ([]int64, error)
-	GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error)
-	CreateDocument(ctx context.Context, files []File) (*string, *int64, error)
-	UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error)
+	GetDocumentVersions(ctx context.Context, documentID string) ([]DocumentVersion, error)
+	GetDocumentVersionsWithFiles(ctx context.Context, documentID string, before int64, limit int, withContent bool) ([]VersionFile, error)
+	CreateDocument(ctx context.Context, files []File, access DocumentAccess, fork *DocumentFork) (*string, *int64, error)
+	UpdateDocument(ctx context.Context, documentID string, files []File, expectedVersion int64) (*int64, error)
 	DeleteDocument(ctx context.Context, documentID string) (*Document, error)
+	TrashDocument(ctx context.Context, documentID string) (*time.Time, error)
+	RestoreDocument(ctx context.Context, documentID string) error
+	DeleteTrashedDocuments(ctx context.Context, before time.Time, limit int) ([]Document, error)
 	DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error)
 	DeleteDocumentVersions(ctx context.Context, documentID string) error
 	DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error)
+	DeleteOldDocumentVersions(ctx context.Context, keepVersions int, keepVersionsFor time.Duration, limit int) ([]Document, error)
 
 	GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error)
 	GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error)
+	GetDocumentFileVersions(ctx context.Context, documentID string, fileName string) ([]File, error)
 	DeleteDocumentFile(ctx context.Context, documentID string, fileName string) error
 	DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error
 
+	GetDocumentTags(ctx context.Context, documentID string) ([]DocumentTag, error)
+	GetDocumentTag(ctx context.Context, documentID string, name string) (*DocumentTag, error)
+	SetDocumentTag(ctx context.Context, documentID string, name string, documentVersion int64) error
+	DeleteDocumentTag(ctx context.Context, documentID string, name string) error
+
+	GetDocumentFork(ctx context.Context, documentID string) (*DocumentFork, error)
+
+	GetDocumentRetention(ctx context.Context, documentID string) (*DocumentRetention, error)
+	SetDocumentRetention(ctx context.Context, documentID string, retention DocumentRetention) error
+
+	GetDocumentVisibility(ctx context.Context, documentID string) (string, error)
+	SetDocumentVisibility(ctx context.Context, documentID string, visibility string) error
+	GetDocumentAccess(ctx context.Context, documentID string) (*DocumentAccess, error)
+	SetDocumentPassword(ctx context.Context, documentID string, passwordHash *string) error
+
+	MigrateBlobs(ctx context.Context, after string, limit int) (string, int, error)
+	DeleteUnreferencedContents(ctx context.Context, before time.Time) (int, error)
+
+	CreateDocumentToken(ctx context.Context, token DocumentToken) error
+	GetDocumentToken(ctx context.Context, tokenID string) (*DocumentToken, error)
+	GetDocumentTokens(ctx context.Context, documentID string) ([]DocumentToken, error)
+	RevokeDocumentToken(ctx context.Context, documentID string, tokenID string) ([]string, error)
+
 	GetWebhook(ctx context.Context, documentID string, webhookID string, secret string) (*Webhook, error)
 	GetWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error)
 	GetAndDeleteWebhooksByDocumentID(ctx context.Context, documentID string) ([]Webhook, error)
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrHeadVersionChanged is returned by UpdateDocument if the head of the document is not the expected version anymore.
+var ErrHeadVersionChanged = errors.New("document head version changed")
+
+// documentVersionKey identifies a version of a document.
+type documentVersionKey struct {
+	DocumentID string
+	Version    int64
+}
+
+// insertDocument inserts a new document with the access and the version of the files as its head.
+func insertDocument(ctx context.Context, tx *sqlx.Tx, files []File, access DocumentAccess) error {
+	documentID, version := files[0].DocumentID, files[0].DocumentVersion
+
+	expiresAt, err := insertVersion(ctx, tx, files)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, "INSERT INTO documents (id, head_version, created_at, expires_at, visibility, password_hash) VALUES ($1, $2, $3, $4, $5, $6);", documentID, version, time.UnixMilli(version), expiresAt, access.Visibility, access.PasswordHash); err != nil {
+		return fmt.Errorf("failed to insert document: %w", err)
+	}
+	return nil
+}
+
+// updateHead inserts the version of the files and moves the head of their document to it.
+// It returns sql.ErrNoRows if the document doesn't exist or is in the trash. If expectedVersion is not 0
+// the head is only moved if it is still at that version, otherwise ErrHeadVersionChanged is returned.
+func updateHead(ctx context.Context, tx *sqlx.Tx, files []File, expectedVersion int64) error {
+	documentID, version := files[0].DocumentID, files[0].DocumentVersion
+
+	if _, err := insertVersion(ctx, tx, files); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, "UPDATE documents SET head_version = $1, expires_at = (SELECT MIN(expires_at) FROM document_versions WHERE document_id = $2) WHERE id = $2 AND deleted_at IS NULL AND (head_version = $3 OR $3 = 0);", version, documentID, expectedVersion)
+	if err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err = tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM documents WHERE id = $1 AND deleted_at IS NULL);", documentID); err != nil {
+		return fmt.Errorf("failed to check document: %w", err)
+	}
+	if exists {
+		return ErrHeadVersionChanged
+	}
+	return sql.ErrNoRows
+}
+
+// insertVersion inserts the version of the files and returns its earliest expiry.
+func insertVersion(ctx context.Context, tx *sqlx.Tx, files []File) (*time.Time, error) {
+	var expiresAt *time.Time
+	for _, file := range files {
+		if file.ExpiresAt != nil && (expiresAt == nil || file.ExpiresAt.Before(*expiresAt)) {
+			expiresAt = file.ExpiresAt
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO document_versions (document_id, version, message, expires_at) VALUES ($1, $2, $3, $4);", files[0].DocumentID, files[0].DocumentVersion, files[0].Message, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to insert document version: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// refreshDocuments updates the versions and documents of deleted files.
+// Versions without files are deleted with their tags, documents without versions are deleted with their fork and tokens.
+func refreshDocuments(ctx context.Context, tx *sqlx.Tx, files []File) error {
+	versions := make(map[documentVersionKey]struct{})
+	documents := make(map[string]struct{})
+	for _, file := range files {
+		versions[documentVersionKey{DocumentID: file.DocumentID, Version: file.DocumentVersion}] = struct{}{}
+		documents[file.DocumentID] = struct{}{}
+	}
+
+	for version := range versions {
+		if err := refreshVersion(ctx, tx, version); err != nil {
+			return err
+		}
+	}
+	for documentID := range documents {
+		if err := refreshDocument(ctx, tx, documentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func refreshVersion(ctx context.Context, tx *sqlx.Tx, version documentVersionKey) error {
+	res, err := tx.ExecContext(ctx, "DELETE FROM document_versions WHERE document_id = $1 AND version = $2 AND NOT EXISTS (SELECT 1 FROM files WHERE document_id = $1 AND document_version = $2);", version.DocumentID, version.Version)
+	if err != nil {
+		return fmt.Errorf("failed to delete document version: %w", err)
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows > 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM document_tags WHERE document_id = $1 AND document_version = $2;", version.DocumentID, version.Version); err != nil {
+			return fmt.Errorf("failed to delete document version tags: %w", err)
+		}
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE document_versions SET expires_at = (SELECT MIN(expires_at) FROM files WHERE document_id = $1 AND document_version = $2) WHERE document_id = $1 AND version = $2;", version.DocumentID, version.Version); err != nil {
+		return fmt.Errorf("failed to update document version: %w", err)
+	}
+	return nil
+}
+
+func refreshDocument(ctx context.Context, tx *sqlx.Tx, documentID string) error {
+	res, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM document_versions WHERE document_id = $1);", documentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if rows, err := res.RowsAffected(); err != nil {
+		return err
+	} else if rows > 0 {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM document_forks WHERE document_id = $1;", documentID); err != nil {
+			return fmt.Errorf("failed to delete document fork: %w", err)
+		}
+		if _, err = tx.ExecContext(ctx, "DELETE FROM document_tokens WHERE document_id = $1;", documentID); err != nil {
+			return fmt.Errorf("failed to delete document tokens: %w", err)
+		}
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, "UPDATE documents SET head_version = (SELECT MAX(version) FROM document_versions WHERE document_id = $1), expires_at = (SELECT MIN(expires_at) FROM document_versions WHERE document_id = $1) WHERE id = $1;", documentID); err != nil {
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestDB(t *testing.T, cfg Config) DB {
+	t.Helper()
+	cfg.Type = TypeSQLite
+	cfg.Path = filepath.Join(t.TempDir(), "gobin.db")
+	db, err := New(context.Background(), cfg, os.DirFS("../.."))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db
+}
+
+func TestUpdateDocumentExpectedVersion(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, Config{})
+
+	documentID, version, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: "1"}}, DocumentAccess{Visibility: "public"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+
+	if _, err = db.UpdateDocument(ctx, *documentID, []File{{Name: "test.txt", Content: "2"}}, *version); err != nil {
+		t.Fatalf("failed to update document: %s", err)
+	}
+
+	if _, err = db.UpdateDocument(ctx, *documentID, []File{{Name: "test.txt", Content: "3"}}, *version); !errors.Is(err, ErrHeadVersionChanged) {
+		t.Fatalf("err = %v, want %v", err, ErrHeadVersionChanged)
+	}
+
+	files, err := db.GetDocument(ctx, *documentID)
+	if err != nil {
+		t.Fatalf("failed to get document: %s", err)
+	}
+	if files[0].Content != "2" {
+		t.Errorf("content = %q, want %q", files[0].Content, "2")
+	}
+}
+
+func TestUpdateDocumentNotFound(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t, Config{})
+
+	documentID, _, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: "1"}}, DocumentAccess{Visibility: "public"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+	if _, err = db.TrashDocument(ctx, *documentID); err != nil {
+		t.Fatalf("failed to trash document: %s", err)
+	}
+
+	for _, id := range []string{*documentID, "missing"} {
+		if _, err = db.UpdateDocument(ctx, id, []File{{Name: "test.txt", Content: "2"}}, 0); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("update %s: err = %v, want %v", id, err, sql.ErrNoRows)
+		}
+	}
+
+	if _, err = db.GetDocument(ctx, "missing"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("get missing: err = %v, want %v", err, sql.ErrNoRows)
+	}
+}
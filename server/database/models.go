@@ -9,9 +9,35 @@ type File struct {
 	DocumentVersion int64      `db:"document_version"`
 	Name            string     `db:"name"`
 	Content         string     `db:"content"`
+	ContentHash     string     `db:"content_hash"`
 	Language        string     `db:"language"`
 	ExpiresAt       *time.Time `db:"expires_at"`
 	OrderIndex      int        `db:"order_index"`
+	Message         string     `db:"message"`
+}
+
+// VersionFile is a file of a document version with its size in bytes and its number of lines.
+type VersionFile struct {
+	File
+	Size  int `db:"size"`
+	Lines int `db:"lines"`
+}
+
+type DocumentVersion struct {
+	Version int64  `db:"document_version"`
+	Message string `db:"message"`
+}
+
+type DocumentTag struct {
+	DocumentID      string `db:"document_id"`
+	Name            string `db:"name"`
+	DocumentVersion int64  `db:"document_version"`
+}
+
+type DocumentFork struct {
+	DocumentID            string `db:"document_id"`
+	ParentDocumentID      string `db:"parent_document_id"`
+	ParentDocumentVersion int64  `db:"parent_document_version"`
 }
 
 type Document struct {
@@ -20,6 +46,33 @@ type Document struct {
 	Files   []File
 }
 
+// DocumentRetention overrides the version retention of the instance for a document.
+// nil uses the instance default and 0 disables the limit.
+type DocumentRetention struct {
+	KeepVersions *int `db:"keep_versions"`
+	// KeepVersionsFor is in milliseconds
+	KeepVersionsFor *int64 `db:"keep_versions_for"`
+}
+
+// DocumentAccess is who can read a document, PasswordHash is nil if the document has no password.
+type DocumentAccess struct {
+	Visibility   string  `db:"visibility"`
+	PasswordHash *string `db:"password_hash"`
+}
+
+// DocumentToken is an issued token of a document, its ID is the jti claim of the token.
+type DocumentToken struct {
+	ID           string     `db:"id"`
+	DocumentID   string     `db:"document_id"`
+	Permissions  int        `db:"permissions"`
+	IssuerID     *string    `db:"issuer_id"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ExpiresAt    *time.Time `db:"expires_at"`
+	RevokedAt    *time.Time `db:"revoked_at"`
+	ScopeVersion *int64     `db:"scope_version"`
+	ScopeFiles   *string    `db:"scope_files"`
+}
+
 type Webhook struct {
 	ID         string `db:"id"`
 	DocumentID string `db:"document_id"`
@@ -12,79 +12,140 @@ import (
 
 var _ DB = (*postgresDB)(nil)
 
-func newPostgresDB(db *sqlx.DB) *postgresDB {
-	return &postgresDB{db}
+func newPostgresDB(db *sqlx.DB, blobs blobStorage) *postgresDB {
+	return &postgresDB{
+		DB:    db,
+		blobs: blobs,
+	}
 }
 
 type postgresDB struct {
 	*sqlx.DB
+	blobs blobStorage
+}
+
+func (d *postgresDB) withTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := d.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withDeleteTx runs fn in a transaction, updates the versions and documents of the files it deleted and releases their blobs.
+// Released blobs stored in the content store are deleted after the transaction is committed.
+func (d *postgresDB) withDeleteTx(ctx context.Context, fn func(tx *sqlx.Tx) ([]File, error)) error {
+	var released []string
+	if err := d.withTx(ctx, func(tx *sqlx.Tx) error {
+		files, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		if err = refreshDocuments(ctx, tx, files); err != nil {
+			return err
+		}
+		released, err = d.blobs.release(ctx, tx, files)
+		return err
+	}); err != nil {
+		return err
+	}
+	d.blobs.deleteContents(ctx, d, released)
+	return nil
+}
+
+// withInsertTx runs fn in a transaction and inserts the files and their blobs after it.
+// Contents stored in the content store are deleted again if the transaction is rolled back.
+func (d *postgresDB) withInsertTx(ctx context.Context, files []File, fn func(tx *sqlx.Tx) error) error {
+	var stored []string
+	if err := d.withTx(ctx, func(tx *sqlx.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		var err error
+		stored, err = d.blobs.insertFiles(ctx, tx, files)
+		return err
+	}); err != nil {
+		// the request may be canceled, which is why the transaction was rolled back
+		d.blobs.deleteContents(context.WithoutCancel(ctx), d, stored)
+		return err
+	}
+	return nil
 }
 
 func (d *postgresDB) GetDocument(ctx context.Context, documentID string) ([]File, error) {
 	var files []File
-	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, expires_at from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND rank = 1 ORDER BY order_index;", documentID); err != nil {
+	if err := d.SelectContext(ctx, &files, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id AND v.version = d.head_version JOIN files f ON f.document_id = d.id AND f.document_version = d.head_version WHERE d.id = $1 AND d.deleted_at IS NULL ORDER BY f.order_index;", documentID); err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
 
 	if len(files) == 0 {
 		return nil, sql.ErrNoRows
 	}
+	if err := d.blobs.loadFiles(ctx, d, files); err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
 	return files, nil
 }
 
 func (d *postgresDB) GetDocumentVersion(ctx context.Context, documentID string, documentVersion int64) ([]File, error) {
 	var files []File
-	if err := d.SelectContext(ctx, &files, "SELECT name, document_id, document_version, content, language, expires_at from files WHERE document_id = $1 AND document_version = $2 ORDER BY order_index;", documentID, documentVersion); err != nil {
+	if err := d.SelectContext(ctx, &files, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id JOIN files f ON f.document_id = v.document_id AND f.document_version = v.version WHERE d.id = $1 AND d.deleted_at IS NULL AND v.version = $2 ORDER BY f.order_index;", documentID, documentVersion); err != nil {
 		return nil, fmt.Errorf("failed to get document version: %w", err)
 	}
 
 	if len(files) == 0 {
 		return nil, sql.ErrNoRows
 	}
+	if err := d.blobs.loadFiles(ctx, d, files); err != nil {
+		return nil, fmt.Errorf("failed to get document version: %w", err)
+	}
 	return files, nil
 }
 
 func (d *postgresDB) GetVersionCount(ctx context.Context, documentID string) (int, error) {
 	var count int
-	err := d.GetContext(ctx, &count, "SELECT COUNT(DISTINCT document_version) FROM files WHERE document_id = $1;", documentID)
+	err := d.GetContext(ctx, &count, "SELECT COUNT(*) FROM documents d JOIN document_versions v ON v.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL;", documentID)
 	return count, err
 }
 
-func (d *postgresDB) GetDocumentVersions(ctx context.Context, documentID string) ([]int64, error) {
-	var versions []int64
-	if err := d.SelectContext(ctx, &versions, "SELECT DISTINCT document_version FROM files WHERE document_id = $1 ORDER BY document_version DESC;", documentID); err != nil {
+func (d *postgresDB) GetDocumentVersions(ctx context.Context, documentID string) ([]DocumentVersion, error) {
+	var versions []DocumentVersion
+	if err := d.SelectContext(ctx, &versions, "SELECT v.version AS document_version, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL ORDER BY v.version DESC;", documentID); err != nil {
 		return nil, fmt.Errorf("failed to get document versions: %w", err)
 	}
 	return versions, nil
 
 }
 
-func (d *postgresDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, withContent bool) (map[int64][]File, error) {
-	var query string
-	if withContent {
-		query = "SELECT name, document_id, document_version, content, language, expires_at WHERE document_id = $1 ORDER BY document_version DESC;"
-	} else {
-		query = "SELECT name, document_id, document_version, language, expires_at WHERE document_id = $1 ORDER BY document_version DESC;"
-	}
-
-	var files []File
-	if err := d.SelectContext(ctx, &files, query, documentID); err != nil {
-		return nil, fmt.Errorf("failed to get document: %w", err)
-	}
-
-	if len(files) == 0 {
-		return nil, sql.ErrNoRows
+// GetDocumentVersionsWithFiles returns the files of up to limit versions older than before, ordered from newest to oldest.
+func (d *postgresDB) GetDocumentVersionsWithFiles(ctx context.Context, documentID string, before int64, limit int, withContent bool) ([]VersionFile, error) {
+	var files []VersionFile
+	if err := d.SelectContext(ctx, &files, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, f.order_index, v.message, b.size, b.lines FROM (SELECT v.document_id, v.version, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL AND v.version < $2 ORDER BY v.version DESC LIMIT $3) AS v JOIN files f ON f.document_id = v.document_id AND f.document_version = v.version JOIN blobs b ON b.hash = f.content_hash ORDER BY f.document_version DESC, f.order_index;", documentID, before, limit); err != nil {
+		return nil, fmt.Errorf("failed to get document versions with files: %w", err)
 	}
 
-	mapFiles := make(map[int64][]File)
-	for _, file := range files {
-		mapFiles[file.DocumentVersion] = append(mapFiles[file.DocumentVersion], file)
+	if withContent {
+		loader := d.blobs.newLoader(d)
+		for i := range files {
+			content, err := loader.load(ctx, files[i].ContentHash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get document versions with files: %w", err)
+			}
+			files[i].Content = content
+		}
 	}
-	return mapFiles, nil
-
+	return files, nil
 }
 
-func (d *postgresDB) CreateDocument(ctx context.Context, files []File) (*string, *int64, error) {
+// CreateDocument inserts the files as a new document with the access, if fork is set it records the document it was forked from.
+func (d *postgresDB) CreateDocument(ctx context.Context, files []File, access DocumentAccess, fork *DocumentFork) (*string, *int64, error) {
 	documentID := randomString(8)
 	version := time.Now().UnixMilli()
 	for i := range files {
@@ -92,110 +153,217 @@ func (d *postgresDB) CreateDocument(ctx context.Context, files []File) (*string,
 		files[i].DocumentVersion = version
 	}
 
-	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, expires_at, order_index) VALUES (:name, :document_id, :document_version, :content, :language, :expires_at, :order_index);", files); err != nil {
+	if err := d.withInsertTx(ctx, files, func(tx *sqlx.Tx) error {
+		if err := insertDocument(ctx, tx, files, access); err != nil {
+			return err
+		}
+		if fork != nil {
+			fork.DocumentID = documentID
+			if _, err := tx.NamedExecContext(ctx, "INSERT INTO document_forks (document_id, parent_document_id, parent_document_version) VALUES (:document_id, :parent_document_id, :parent_document_version);", fork); err != nil {
+				return fmt.Errorf("failed to create document fork: %w", err)
+			}
+		}
+		return nil
+	}); err != nil {
 		return nil, nil, fmt.Errorf("failed to create document: %w", err)
 	}
 	return &documentID, &version, nil
 }
 
-func (d *postgresDB) UpdateDocument(ctx context.Context, documentID string, files []File) (*int64, error) {
+// UpdateDocument inserts the files as new head version of the document, it returns sql.ErrNoRows if the document doesn't exist or is in the trash.
+// If expectedVersion is not 0 and the head of the document has changed ErrHeadVersionChanged is returned.
+func (d *postgresDB) UpdateDocument(ctx context.Context, documentID string, files []File, expectedVersion int64) (*int64, error) {
 	version := time.Now().UnixMilli()
 	for i := range files {
 		files[i].DocumentID = documentID
 		files[i].DocumentVersion = version
 	}
-	if _, err := d.NamedExecContext(ctx, "INSERT INTO files (name, document_id, document_version, content, language, expires_at) VALUES (:name, :document_id, :document_version, :content, :language, :expires_at);", files); err != nil {
+	if err := d.withInsertTx(ctx, files, func(tx *sqlx.Tx) error {
+		return updateHead(ctx, tx, files, expectedVersion)
+	}); err != nil {
 		return nil, fmt.Errorf("failed to update document: %w", err)
 	}
 	return &version, nil
 }
 
+// DeleteDocument deletes a document including its versions, documents in the trash can be deleted too.
 func (d *postgresDB) DeleteDocument(ctx context.Context, documentID string) (*Document, error) {
-	var files []File
-	if err := d.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 RETURNING *", documentID); err != nil {
-		return nil, fmt.Errorf("failed to delete document: %w", err)
+	var document *Document
+	if err := d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var (
+			files []File
+			err   error
+		)
+		document, files, err = d.deleteDocument(ctx, tx, documentID)
+		return files, err
+	}); err != nil {
+		return nil, err
 	}
+	return document, nil
+}
 
-	if len(files) == 0 {
-		return nil, sql.ErrNoRows
+// deleteDocument deletes all files of a document and returns the document with the files of its head version and all deleted files.
+func (d *postgresDB) deleteDocument(ctx context.Context, tx *sqlx.Tx, documentID string) (*Document, []File, error) {
+	var headVersion int64
+	if err := tx.GetContext(ctx, &headVersion, "SELECT head_version FROM documents WHERE id = $1;", documentID); err != nil {
+		return nil, nil, err
+	}
+
+	var files []File
+	if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 RETURNING *;", documentID); err != nil {
+		return nil, nil, fmt.Errorf("failed to delete document: %w", err)
 	}
 
-	var lastDeletedFiles []File
-	for i := len(files) - 1; i >= 0; i-- {
-		if files[i].DocumentVersion != files[len(files)-1].DocumentVersion {
-			break
+	var headFiles []File
+	for _, file := range files {
+		if file.DocumentVersion == headVersion {
+			headFiles = append(headFiles, file)
 		}
-		lastDeletedFiles = append(lastDeletedFiles, files[i])
 	}
 
+	if err := d.blobs.loadFiles(ctx, tx, headFiles); err != nil {
+		return nil, nil, err
+	}
 	return &Document{
 		ID:      documentID,
-		Version: files[len(files)-1].DocumentVersion,
-		Files:   lastDeletedFiles,
-	}, nil
+		Version: headVersion,
+		Files:   headFiles,
+	}, files, nil
 }
 
-func (d *postgresDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
-	var files []File
-	if err := d.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 RETURNING *;", documentID, documentVersion); err != nil {
-		return nil, fmt.Errorf("failed to delete document version: %w", err)
+// TrashDocument moves a document to the trash, it is hidden until it is restored or deleted.
+func (d *postgresDB) TrashDocument(ctx context.Context, documentID string) (*time.Time, error) {
+	now := time.Now()
+	res, err := d.ExecContext(ctx, "UPDATE documents SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL;", now, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to trash document: %w", err)
 	}
-
-	if len(files) == 0 {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rows == 0 {
 		return nil, sql.ErrNoRows
 	}
+	return &now, nil
+}
+
+// RestoreDocument moves a document out of the trash.
+func (d *postgresDB) RestoreDocument(ctx context.Context, documentID string) error {
+	res, err := d.ExecContext(ctx, "UPDATE documents SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL;", documentID)
+	if err != nil {
+		return fmt.Errorf("failed to restore document: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteTrashedDocuments deletes up to limit documents which were moved to the trash before the given time.
+func (d *postgresDB) DeleteTrashedDocuments(ctx context.Context, before time.Time, limit int) ([]Document, error) {
+	var documents []Document
+	if err := d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var documentIDs []string
+		if err := tx.SelectContext(ctx, &documentIDs, "SELECT id FROM documents WHERE deleted_at < $1 ORDER BY id LIMIT $2;", before, limit); err != nil {
+			return nil, fmt.Errorf("failed to get trashed documents: %w", err)
+		}
+
+		var deleted []File
+		for _, documentID := range documentIDs {
+			document, files, err := d.deleteDocument(ctx, tx, documentID)
+			if err != nil {
+				return nil, err
+			}
+			documents = append(documents, *document)
+			deleted = append(deleted, files...)
+		}
+		return deleted, nil
+	}); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+func (d *postgresDB) DeleteDocumentVersion(ctx context.Context, documentID string, documentVersion int64) (*Document, error) {
+	var files []File
+	if err := d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 AND document_id IN (SELECT id FROM documents WHERE deleted_at IS NULL) RETURNING *;", documentID, documentVersion); err != nil {
+			return nil, fmt.Errorf("failed to delete document version: %w", err)
+		}
+
+		if len(files) == 0 {
+			return nil, sql.ErrNoRows
+		}
 
-	var lastDeletedFiles []File
-	for i := len(files) - 1; i >= 0; i-- {
-		if files[i].DocumentVersion != files[len(files)-1].DocumentVersion {
-			break
+		if err := d.blobs.loadFiles(ctx, tx, files); err != nil {
+			return nil, err
 		}
-		lastDeletedFiles = append(lastDeletedFiles, files[i])
+		return files, nil
+	}); err != nil {
+		return nil, err
 	}
 
 	return &Document{
 		ID:      documentID,
 		Version: documentVersion,
-		Files:   lastDeletedFiles,
+		Files:   files,
 	}, nil
 }
 
 func (d *postgresDB) DeleteDocumentVersions(ctx context.Context, documentID string) error {
-	if _, err := d.ExecContext(ctx, "DELETE FROM files WHERE document_id = $1;", documentID); err != nil {
-		return fmt.Errorf("failed to delete document versions: %w", err)
-	}
-	return nil
+	return d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var files []File
+		if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 RETURNING *;", documentID); err != nil {
+			return nil, fmt.Errorf("failed to delete document versions: %w", err)
+		}
+		return files, nil
+	})
 }
 
 func (d *postgresDB) DeleteExpiredDocuments(ctx context.Context, expireAfter time.Duration) ([]Document, error) {
 	now := time.Now()
-	query := "DELETE FROM files WHERE expires_at < $1"
-	args := []interface{}{now}
+	// versions created before the cutoff are expired, 0 disables it
+	var cutoff int64
 	if expireAfter > 0 {
-		query += " OR document_version < $2"
-		args = append(args, now.Add(expireAfter).UnixMilli())
-	}
-	query += " RETURNING *;"
-	var files []File
-	if err := d.SelectContext(ctx, &files, query, args...); err != nil {
-		return nil, fmt.Errorf("failed to delete expired documents: %w", err)
+		cutoff = now.Add(-expireAfter).UnixMilli()
 	}
 
 	documents := make(map[string]Document)
-	for _, file := range files {
-		document, ok := documents[file.DocumentID]
-		if !ok || file.DocumentVersion > document.Version {
-			document = Document{
-				ID:      file.DocumentID,
-				Version: file.DocumentVersion,
-			}
+	if err := d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var files []File
+		if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE (document_id, document_version) IN (SELECT document_id, version FROM document_versions WHERE expires_at < $1 OR version < $2) AND (expires_at < $1 OR document_version < $2) RETURNING *;", now, cutoff); err != nil {
+			return nil, fmt.Errorf("failed to delete expired documents: %w", err)
 		}
-		if file.DocumentVersion < document.Version {
-			continue
+
+		for _, file := range files {
+			document, ok := documents[file.DocumentID]
+			if !ok || file.DocumentVersion > document.Version {
+				document = Document{
+					ID:      file.DocumentID,
+					Version: file.DocumentVersion,
+				}
+			}
+			if file.DocumentVersion < document.Version {
+				continue
+			}
+
+			document.Files = append(document.Files, file)
+			documents[file.DocumentID] = document
 		}
 
-		document.Files = append(document.Files, file)
-		documents[file.DocumentID] = document
+		for _, document := range documents {
+			if err := d.blobs.loadFiles(ctx, tx, document.Files); err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	}); err != nil {
+		return nil, err
 	}
 
 	documentsSlice := make([]Document, 0, len(documents))
@@ -205,9 +373,50 @@ func (d *postgresDB) DeleteExpiredDocuments(ctx context.Context, expireAfter tim
 	return documentsSlice, nil
 }
 
+// DeleteOldDocumentVersions deletes up to limit versions which are not retained by the version retention of their document.
+// keepVersions and keepVersionsFor are the instance defaults, 0 disables the limit. The head and tagged versions are always retained.
+func (d *postgresDB) DeleteOldDocumentVersions(ctx context.Context, keepVersions int, keepVersionsFor time.Duration, limit int) ([]Document, error) {
+	var documents []Document
+	if err := d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var versions []struct {
+			DocumentID string `db:"document_id"`
+			Version    int64  `db:"version"`
+		}
+		if err := tx.SelectContext(ctx, &versions, "SELECT document_id, version FROM (SELECT v.document_id, v.version, d.head_version, ROW_NUMBER() OVER (PARTITION BY v.document_id ORDER BY v.version DESC) AS position, COALESCE(d.keep_versions, $1) AS keep_versions, COALESCE(d.keep_versions_for, $2) AS keep_versions_for FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.deleted_at IS NULL) v WHERE version != head_version AND ((keep_versions > 0 AND position > keep_versions) OR (keep_versions_for > 0 AND version < $3 - keep_versions_for)) AND NOT EXISTS (SELECT 1 FROM document_tags t WHERE t.document_id = v.document_id AND t.document_version = v.version) ORDER BY document_id, version LIMIT $4;", keepVersions, keepVersionsFor.Milliseconds(), time.Now().UnixMilli(), limit); err != nil {
+			return nil, fmt.Errorf("failed to get old document versions: %w", err)
+		}
+
+		var deleted []File
+		for _, version := range versions {
+			var files []File
+			if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 RETURNING *;", version.DocumentID, version.Version); err != nil {
+				return nil, fmt.Errorf("failed to delete old document version: %w", err)
+			}
+			if err := d.blobs.loadFiles(ctx, tx, files); err != nil {
+				return nil, err
+			}
+			documents = append(documents, Document{
+				ID:      version.DocumentID,
+				Version: version.Version,
+				Files:   files,
+			})
+			deleted = append(deleted, files...)
+		}
+		return deleted, nil
+	}); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
 func (d *postgresDB) GetDocumentFile(ctx context.Context, documentID string, fileName string) (*File, error) {
 	var file File
-	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, expires_at from (SELECT *, rank() OVER (PARTITION BY document_id ORDER BY document_version DESC) AS rank FROM files) AS f WHERE document_id = $1 AND name = $2 AND rank = 1;", documentID, fileName); err != nil {
+	if err := d.GetContext(ctx, &file, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id AND v.version = d.head_version JOIN files f ON f.document_id = d.id AND f.document_version = d.head_version WHERE d.id = $1 AND d.deleted_at IS NULL AND f.name = $2;", documentID, fileName); err != nil {
+		return nil, fmt.Errorf("failed to get document file: %w", err)
+	}
+
+	var err error
+	if file.Content, err = d.blobs.newLoader(d).load(ctx, file.ContentHash); err != nil {
 		return nil, fmt.Errorf("failed to get document file: %w", err)
 	}
 
@@ -216,32 +425,223 @@ func (d *postgresDB) GetDocumentFile(ctx context.Context, documentID string, fil
 
 func (d *postgresDB) GetDocumentFileVersion(ctx context.Context, documentID string, documentVersion int64, fileName string) (*File, error) {
 	var file File
-	if err := d.GetContext(ctx, &file, "SELECT name, document_id, document_version, content, language, expires_at from files WHERE document_id = $1 AND document_version = $2 AND name = $3;", documentID, documentVersion, fileName); err != nil {
+	if err := d.GetContext(ctx, &file, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id JOIN files f ON f.document_id = v.document_id AND f.document_version = v.version WHERE d.id = $1 AND d.deleted_at IS NULL AND v.version = $2 AND f.name = $3;", documentID, documentVersion, fileName); err != nil {
+		return nil, fmt.Errorf("failed to get document file version: %w", err)
+	}
+
+	var err error
+	if file.Content, err = d.blobs.newLoader(d).load(ctx, file.ContentHash); err != nil {
 		return nil, fmt.Errorf("failed to get document file version: %w", err)
 	}
 
 	return &file, nil
 }
 
+func (d *postgresDB) GetDocumentFileVersions(ctx context.Context, documentID string, fileName string) ([]File, error) {
+	var files []File
+	if err := d.SelectContext(ctx, &files, "SELECT f.name, f.document_id, f.document_version, f.content_hash, f.language, f.expires_at, v.message FROM documents d JOIN document_versions v ON v.document_id = d.id JOIN files f ON f.document_id = v.document_id AND f.document_version = v.version WHERE d.id = $1 AND d.deleted_at IS NULL AND f.name = $2 ORDER BY f.document_version;", documentID, fileName); err != nil {
+		return nil, fmt.Errorf("failed to get document file versions: %w", err)
+	}
+
+	if err := d.blobs.loadFiles(ctx, d, files); err != nil {
+		return nil, fmt.Errorf("failed to get document file versions: %w", err)
+	}
+
+	return files, nil
+}
+
 func (d *postgresDB) DeleteDocumentFile(ctx context.Context, documentID string, fileName string) error {
-	if _, err := d.ExecContext(ctx, "DELETE FROM files WHERE document_id = $1 AND name = $2;", documentID, fileName); err != nil {
-		return fmt.Errorf("failed to delete document file: %w", err)
+	return d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var files []File
+		if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND name = $2 AND document_id IN (SELECT id FROM documents WHERE deleted_at IS NULL) RETURNING *;", documentID, fileName); err != nil {
+			return nil, fmt.Errorf("failed to delete document file: %w", err)
+		}
+		return files, nil
+	})
+}
+
+func (d *postgresDB) DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
+	return d.withDeleteTx(ctx, func(tx *sqlx.Tx) ([]File, error) {
+		var files []File
+		if err := tx.SelectContext(ctx, &files, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 AND name = $3 AND document_id IN (SELECT id FROM documents WHERE deleted_at IS NULL) RETURNING *;", documentID, documentVersion, fileName); err != nil {
+			return nil, fmt.Errorf("failed to delete document version file: %w", err)
+		}
+		return files, nil
+	})
+}
+
+func (d *postgresDB) MigrateBlobs(ctx context.Context, after string, limit int) (string, int, error) {
+	return d.blobs.migrate(ctx, d.DB, after, limit)
+}
+
+func (d *postgresDB) DeleteUnreferencedContents(ctx context.Context, before time.Time) (int, error) {
+	return d.blobs.deleteUnreferencedContents(ctx, d, before)
+}
+
+func (d *postgresDB) GetDocumentTags(ctx context.Context, documentID string) ([]DocumentTag, error) {
+	var tags []DocumentTag
+	if err := d.SelectContext(ctx, &tags, "SELECT t.document_id, t.name, t.document_version FROM documents d JOIN document_tags t ON t.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL ORDER BY t.name;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (d *postgresDB) GetDocumentTag(ctx context.Context, documentID string, name string) (*DocumentTag, error) {
+	var tag DocumentTag
+	if err := d.GetContext(ctx, &tag, "SELECT t.document_id, t.name, t.document_version FROM documents d JOIN document_tags t ON t.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL AND t.name = $2;", documentID, name); err != nil {
+		return nil, fmt.Errorf("failed to get document tag: %w", err)
 	}
+	return &tag, nil
+}
 
+func (d *postgresDB) SetDocumentTag(ctx context.Context, documentID string, name string, documentVersion int64) error {
+	if _, err := d.ExecContext(ctx, "INSERT INTO document_tags (document_id, name, document_version) VALUES ($1, $2, $3) ON CONFLICT (document_id, name) DO UPDATE SET document_version = excluded.document_version;", documentID, name, documentVersion); err != nil {
+		return fmt.Errorf("failed to set document tag: %w", err)
+	}
 	return nil
 }
 
-func (d *postgresDB) DeleteDocumentVersionFile(ctx context.Context, documentID string, documentVersion int64, fileName string) error {
-	if _, err := d.ExecContext(ctx, "DELETE FROM files WHERE document_id = $1 AND document_version = $2 AND name = $3;", documentID, documentVersion, fileName); err != nil {
-		return fmt.Errorf("failed to delete document version file: %w", err)
+func (d *postgresDB) DeleteDocumentTag(ctx context.Context, documentID string, name string) error {
+	res, err := d.ExecContext(ctx, "DELETE FROM document_tags WHERE document_id = $1 AND name = $2;", documentID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete document tag: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentFork(ctx context.Context, documentID string) (*DocumentFork, error) {
+	var fork DocumentFork
+	if err := d.GetContext(ctx, &fork, "SELECT f.document_id, f.parent_document_id, f.parent_document_version FROM documents d JOIN document_forks f ON f.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document fork: %w", err)
 	}
+	return &fork, nil
+}
 
+func (d *postgresDB) GetDocumentRetention(ctx context.Context, documentID string) (*DocumentRetention, error) {
+	var retention DocumentRetention
+	if err := d.GetContext(ctx, &retention, "SELECT keep_versions, keep_versions_for FROM documents WHERE id = $1 AND deleted_at IS NULL;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document retention: %w", err)
+	}
+	return &retention, nil
+}
+
+func (d *postgresDB) SetDocumentRetention(ctx context.Context, documentID string, retention DocumentRetention) error {
+	res, err := d.ExecContext(ctx, "UPDATE documents SET keep_versions = $1, keep_versions_for = $2 WHERE id = $3 AND deleted_at IS NULL;", retention.KeepVersions, retention.KeepVersionsFor, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to set document retention: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentVisibility(ctx context.Context, documentID string) (string, error) {
+	var visibility string
+	if err := d.GetContext(ctx, &visibility, "SELECT visibility FROM documents WHERE id = $1 AND deleted_at IS NULL;", documentID); err != nil {
+		return "", fmt.Errorf("failed to get document visibility: %w", err)
+	}
+	return visibility, nil
+}
+
+func (d *postgresDB) SetDocumentVisibility(ctx context.Context, documentID string, visibility string) error {
+	res, err := d.ExecContext(ctx, "UPDATE documents SET visibility = $1 WHERE id = $2 AND deleted_at IS NULL;", visibility, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to set document visibility: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
 	return nil
 }
 
+func (d *postgresDB) GetDocumentAccess(ctx context.Context, documentID string) (*DocumentAccess, error) {
+	var access DocumentAccess
+	if err := d.GetContext(ctx, &access, "SELECT visibility, password_hash FROM documents WHERE id = $1 AND deleted_at IS NULL;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document access: %w", err)
+	}
+	return &access, nil
+}
+
+func (d *postgresDB) SetDocumentPassword(ctx context.Context, documentID string, passwordHash *string) error {
+	res, err := d.ExecContext(ctx, "UPDATE documents SET password_hash = $1 WHERE id = $2 AND deleted_at IS NULL;", passwordHash, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to set document password: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (d *postgresDB) CreateDocumentToken(ctx context.Context, token DocumentToken) error {
+	if _, err := d.NamedExecContext(ctx, "INSERT INTO document_tokens (id, document_id, permissions, issuer_id, created_at, expires_at, scope_version, scope_files) VALUES (:id, :document_id, :permissions, :issuer_id, :created_at, :expires_at, :scope_version, :scope_files);", token); err != nil {
+		return fmt.Errorf("failed to create document token: %w", err)
+	}
+	return nil
+}
+
+func (d *postgresDB) GetDocumentToken(ctx context.Context, tokenID string) (*DocumentToken, error) {
+	var token DocumentToken
+	if err := d.GetContext(ctx, &token, "SELECT id, document_id, permissions, issuer_id, created_at, expires_at, revoked_at, scope_version, scope_files FROM document_tokens WHERE id = $1;", tokenID); err != nil {
+		return nil, fmt.Errorf("failed to get document token: %w", err)
+	}
+	return &token, nil
+}
+
+func (d *postgresDB) GetDocumentTokens(ctx context.Context, documentID string) ([]DocumentToken, error) {
+	var tokens []DocumentToken
+	if err := d.SelectContext(ctx, &tokens, "SELECT id, document_id, permissions, issuer_id, created_at, expires_at, revoked_at, scope_version, scope_files FROM document_tokens WHERE document_id = $1 ORDER BY created_at, id;", documentID); err != nil {
+		return nil, fmt.Errorf("failed to get document tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// RevokeDocumentToken revokes a token and all tokens which were shared with it, directly or through other tokens.
+// It returns the IDs of the newly revoked tokens.
+func (d *postgresDB) RevokeDocumentToken(ctx context.Context, documentID string, tokenID string) ([]string, error) {
+	var revoked []string
+	if err := d.withTx(ctx, func(tx *sqlx.Tx) error {
+		var exists bool
+		if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM document_tokens WHERE document_id = $1 AND id = $2);", documentID, tokenID); err != nil {
+			return fmt.Errorf("failed to get document token: %w", err)
+		}
+		if !exists {
+			return sql.ErrNoRows
+		}
+
+		if err := tx.SelectContext(ctx, &revoked, "WITH RECURSIVE issued (id) AS (SELECT id FROM document_tokens WHERE id = $1 UNION SELECT t.id FROM document_tokens t JOIN issued i ON t.issuer_id = i.id) UPDATE document_tokens SET revoked_at = $2 WHERE id IN (SELECT id FROM issued) AND revoked_at IS NULL RETURNING id;", tokenID, time.Now()); err != nil {
+			return fmt.Errorf("failed to revoke document token: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return revoked, nil
+}
+
 func (d *postgresDB) GetWebhook(ctx context.Context, documentID string, webhookID string, secret string) (*Webhook, error) {
 	var webhook Webhook
-	err := d.GetContext(ctx, &webhook, "SELECT * FROM webhooks WHERE document_id = $1 AND id = $2 AND secret = $3", documentID, webhookID, secret)
+	err := d.GetContext(ctx, &webhook, "SELECT w.* FROM documents d JOIN webhooks w ON w.document_id = d.id WHERE d.id = $1 AND d.deleted_at IS NULL AND w.id = $2 AND w.secret = $3", documentID, webhookID, secret)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,326 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/topi314/gobin/v3/internal/timex"
+)
+
+const (
+	snapshotPrefix     = "gobin-"
+	snapshotExtension  = ".db"
+	snapshotTimeLayout = "20060102T150405Z"
+)
+
+var ErrSnapshotNotSupported = errors.New("snapshots are only supported for SQLite databases")
+
+type BackupTarget string
+
+const (
+	BackupTargetDir         BackupTarget = "dir"
+	BackupTargetObjectStore BackupTarget = "object_store"
+)
+
+func (t BackupTarget) Valid() bool {
+	switch t {
+	case BackupTargetDir, BackupTargetObjectStore:
+		return true
+	default:
+		return false
+	}
+}
+
+// BackupConfig configures periodic snapshots of a SQLite database.
+type BackupConfig struct {
+	Enabled    bool           `toml:"enabled"`
+	Interval   timex.Duration `toml:"interval"`
+	Target     BackupTarget   `toml:"target"`
+	Dir        string         `toml:"dir"`
+	Prefix     string         `toml:"prefix"`
+	KeepHourly int            `toml:"keep_hourly"`
+	KeepDaily  int            `toml:"keep_daily"`
+}
+
+func (c BackupConfig) String() string {
+	return fmt.Sprintf("\n   Enabled: %t\n   Interval: %s\n   Target: %s\n   Dir: %s\n   Prefix: %s\n   KeepHourly: %d\n   KeepDaily: %d",
+		c.Enabled,
+		time.Duration(c.Interval),
+		c.Target,
+		c.Dir,
+		c.Prefix,
+		c.KeepHourly,
+		c.KeepDaily,
+	)
+}
+
+// SnapshotInfo is a snapshot in a SnapshotStore.
+type SnapshotInfo struct {
+	Name      string
+	CreatedAt time.Time
+}
+
+// SnapshotStore stores database snapshots, snapshots are identified by their name.
+type SnapshotStore interface {
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+	// List returns the names of all stored snapshots.
+	List(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// NewSnapshotStore returns the SnapshotStore configured in the backup config of the database.
+func NewSnapshotStore(ctx context.Context, cfg Config) (SnapshotStore, error) {
+	if cfg.Type != TypeSQLite {
+		return nil, ErrSnapshotNotSupported
+	}
+
+	switch cfg.Backup.Target {
+	case BackupTargetDir:
+		return NewDirSnapshotStore(cfg.Backup.Dir)
+	case BackupTargetObjectStore:
+		client, err := newS3Client(ctx, cfg.ObjectStore)
+		if err != nil {
+			return nil, err
+		}
+		return &s3SnapshotStore{
+			client: client,
+			bucket: cfg.ObjectStore.Bucket,
+			prefix: cfg.ObjectStore.Prefix + cfg.Backup.Prefix,
+		}, nil
+	default:
+		return nil, errors.New("invalid database backup target, must be one of: dir, object_store")
+	}
+}
+
+// Snapshot writes a consistent copy of the SQLite database with VACUUM INTO and puts it into the store.
+// Contents stored in the object store are copied into the snapshot, as their objects are deleted once no blob references them anymore.
+// It returns the stored snapshot.
+func Snapshot(ctx context.Context, db DB, store SnapshotStore, now time.Time) (*SnapshotInfo, error) {
+	sqlite, ok := db.(*sqliteDB)
+	if !ok {
+		return nil, ErrSnapshotNotSupported
+	}
+
+	tempDir, err := os.MkdirTemp("", "gobin-snapshot-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tempDir)
+	}()
+
+	path := filepath.Join(tempDir, "snapshot.db")
+	if _, err = sqlite.ExecContext(ctx, "VACUUM INTO $1;", path); err != nil {
+		return nil, fmt.Errorf("failed to vacuum into snapshot: %w", err)
+	}
+	if err = sqlite.blobs.inlineContents(ctx, path); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat snapshot: %w", err)
+	}
+
+	snapshot := SnapshotInfo{
+		Name:      snapshotPrefix + now.UTC().Format(snapshotTimeLayout) + snapshotExtension,
+		CreatedAt: now.UTC().Truncate(time.Second),
+	}
+	if err = store.Put(ctx, snapshot.Name, file, info.Size()); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return &snapshot, nil
+}
+
+// ListSnapshots returns all snapshots in the store, newest first. Objects which are not snapshots are ignored.
+func ListSnapshots(ctx context.Context, store SnapshotStore) ([]SnapshotInfo, error) {
+	names, err := store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []SnapshotInfo
+	for _, name := range names {
+		timestamp, ok := strings.CutPrefix(name, snapshotPrefix)
+		if !ok {
+			continue
+		}
+		if timestamp, ok = strings.CutSuffix(timestamp, snapshotExtension); !ok {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeLayout, timestamp)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{
+			Name:      name,
+			CreatedAt: createdAt,
+		})
+	}
+	slices.SortFunc(snapshots, func(a, b SnapshotInfo) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return snapshots, nil
+}
+
+// PruneSnapshots deletes all snapshots which are not retained and returns the deleted snapshots.
+// The newest snapshot of each of the last keepHourly hours and keepDaily days with a snapshot is retained,
+// the newest snapshot is always retained.
+func PruneSnapshots(ctx context.Context, store SnapshotStore, keepHourly int, keepDaily int) ([]SnapshotInfo, error) {
+	snapshots, err := ListSnapshots(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		hours   = make(map[time.Time]struct{})
+		days    = make(map[time.Time]struct{})
+		deleted []SnapshotInfo
+	)
+	for i, snapshot := range snapshots {
+		keep := i == 0
+
+		hour := snapshot.CreatedAt.Truncate(time.Hour)
+		if _, ok := hours[hour]; !ok && len(hours) < keepHourly {
+			hours[hour] = struct{}{}
+			keep = true
+		}
+
+		day := time.Date(snapshot.CreatedAt.Year(), snapshot.CreatedAt.Month(), snapshot.CreatedAt.Day(), 0, 0, 0, 0, time.UTC)
+		if _, ok := days[day]; !ok && len(days) < keepDaily {
+			days[day] = struct{}{}
+			keep = true
+		}
+
+		if keep {
+			continue
+		}
+		if err = store.Delete(ctx, snapshot.Name); err != nil {
+			return deleted, fmt.Errorf("failed to delete snapshot %s: %w", snapshot.Name, err)
+		}
+		deleted = append(deleted, snapshot)
+	}
+	return deleted, nil
+}
+
+var _ SnapshotStore = (*dirSnapshotStore)(nil)
+
+// NewDirSnapshotStore returns a SnapshotStore which stores snapshots as files in a local directory.
+// It can also be used as a local stand-in for an object store.
+func NewDirSnapshotStore(dir string) (SnapshotStore, error) {
+	if dir == "" {
+		return nil, errors.New("database backup dir is required")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup dir: %w", err)
+	}
+	return &dirSnapshotStore{
+		dir: dir,
+	}, nil
+}
+
+type dirSnapshotStore struct {
+	dir string
+}
+
+func (s *dirSnapshotStore) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	path := filepath.Join(s.dir, name)
+	// write to a temporary file first, so a partial snapshot is never listed
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	if _, err = io.Copy(file, r); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err = file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	if err = os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+func (s *dirSnapshotStore) List(_ context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dir: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *dirSnapshotStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+var _ SnapshotStore = (*s3SnapshotStore)(nil)
+
+type s3SnapshotStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3SnapshotStore) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	if _, err := s.client.PutObject(ctx, s.bucket, s.prefix+name, r, size, minio.PutObjectOptions{
+		ContentType: "application/vnd.sqlite3",
+	}); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+func (s *s3SnapshotStore) List(ctx context.Context) ([]string, error) {
+	var names []string
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix: s.prefix,
+	}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		names = append(names, strings.TrimPrefix(object.Key, s.prefix))
+	}
+	return names, nil
+}
+
+func (s *s3SnapshotStore) Delete(ctx context.Context, name string) error {
+	if err := s.client.RemoveObject(ctx, s.bucket, s.prefix+name, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotInlinesContents(t *testing.T) {
+	ctx := context.Background()
+	db, store := newTestContentStoreDB(t)
+
+	documentID, _, err := db.CreateDocument(ctx, []File{{Name: "test.txt", Content: "external"}}, DocumentAccess{Visibility: "public"}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+
+	dir := t.TempDir()
+	snapshots, err := NewDirSnapshotStore(dir)
+	if err != nil {
+		t.Fatalf("failed to create snapshot store: %s", err)
+	}
+	snapshot, err := Snapshot(ctx, db, snapshots, time.Now())
+	if err != nil {
+		t.Fatalf("failed to snapshot database: %s", err)
+	}
+
+	// deleting the document deletes its objects, the snapshot has to restore without them
+	if _, err = db.DeleteDocument(ctx, *documentID); err != nil {
+		t.Fatalf("failed to delete document: %s", err)
+	}
+	if count := countObjects(t, store); count != 0 {
+		t.Fatalf("objects = %d, want 0", count)
+	}
+
+	restored, err := New(ctx, Config{
+		Type: TypeSQLite,
+		Path: filepath.Join(dir, snapshot.Name),
+	}, os.DirFS("../.."))
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %s", err)
+	}
+	defer func() {
+		_ = restored.Close()
+	}()
+
+	files, err := restored.GetDocument(ctx, *documentID)
+	if err != nil {
+		t.Fatalf("failed to get document: %s", err)
+	}
+	if files[0].Content != "external" {
+		t.Errorf("content = %q, want %q", files[0].Content, "external")
+	}
+}
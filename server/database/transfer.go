@@ -0,0 +1,469 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// transferProgressTable stores how far Transfer got in the destination database, so it can resume after an interruption.
+	transferProgressTable = "transfer_progress"
+	// transferMaxArgs is the maximum number of parameters of a statement in SQLite, PostgreSQL allows 65535
+	transferMaxArgs = 32766
+)
+
+var ErrTransferDestinationNotEmpty = errors.New("destination database is not empty")
+
+// transferTable is a table copied by Transfer, rows are copied ordered by their primary key.
+type transferTable struct {
+	Name string
+	Key  []string
+}
+
+// transferTables are all tables copied by Transfer.
+// Every table added by a migration has to be listed here, Transfer refuses to run if the source has unknown tables.
+var transferTables = []transferTable{
+	{Name: "documents", Key: []string{"id"}},
+	{Name: "document_versions", Key: []string{"document_id", "version"}},
+	{Name: "files", Key: []string{"document_id", "document_version", "name"}},
+	{Name: "blobs", Key: []string{"hash"}},
+	{Name: "document_tags", Key: []string{"document_id", "name"}},
+	{Name: "document_forks", Key: []string{"document_id"}},
+	{Name: "webhooks", Key: []string{"id"}},
+	{Name: "document_tokens", Key: []string{"id"}},
+}
+
+// TransferProgress is reported by Transfer after every copied batch.
+type TransferProgress struct {
+	Table  string
+	Copied int64
+	Done   bool
+}
+
+// Transfer copies all rows from one database to another in batches of batchSize rows.
+// Both databases have to be migrated to the same schema. The destination has to be empty unless a previous Transfer into it was interrupted,
+// in which case it resumes after the last copied batch.
+// All rows are read in one read-only transaction, so the copy is a consistent snapshot of the source, unless the transfer is resumed.
+func Transfer(ctx context.Context, from DB, to DB, batchSize int, progress func(TransferProgress)) error {
+	src, srcType, err := sqlxOf(from)
+	if err != nil {
+		return err
+	}
+	dst, dstType, err := sqlxOf(to)
+	if err != nil {
+		return err
+	}
+
+	if err = checkTransferTables(ctx, src, srcType); err != nil {
+		return err
+	}
+
+	dstTables, err := tablesOf(ctx, dst, dstType)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(dstTables, transferProgressTable) {
+		if err = checkTransferEmpty(ctx, dst); err != nil {
+			return err
+		}
+		if _, err = dst.ExecContext(ctx, "CREATE TABLE "+transferProgressTable+" (table_name VARCHAR PRIMARY KEY, last_key VARCHAR NOT NULL, copied BIGINT NOT NULL, done BOOLEAN NOT NULL);"); err != nil {
+			return fmt.Errorf("failed to create transfer progress table: %w", err)
+		}
+	}
+
+	// a SQLite transaction reads a snapshot, PostgreSQL needs repeatable read for it
+	opts := &sql.TxOptions{ReadOnly: true}
+	if srcType == TypePostgres {
+		opts.Isolation = sql.LevelRepeatableRead
+	}
+	srcTx, err := src.BeginTxx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin source transaction: %w", err)
+	}
+	defer func() {
+		_ = srcTx.Rollback()
+	}()
+
+	for _, table := range transferTables {
+		if err = transferTableRows(ctx, srcTx, dst, table, batchSize, progress); err != nil {
+			return fmt.Errorf("failed to transfer table %s: %w", table.Name, err)
+		}
+	}
+	return nil
+}
+
+func transferTableRows(ctx context.Context, src *sqlx.Tx, dst *sqlx.DB, table transferTable, batchSize int, progress func(TransferProgress)) error {
+	var state struct {
+		LastKey string `db:"last_key"`
+		Copied  int64  `db:"copied"`
+		Done    bool   `db:"done"`
+	}
+	if err := dst.GetContext(ctx, &state, "SELECT last_key, copied, done FROM "+transferProgressTable+" WHERE table_name = $1;", table.Name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to get progress: %w", err)
+	}
+	if state.Done {
+		return nil
+	}
+
+	var lastKey []any
+	if state.LastKey != "" {
+		if err := json.Unmarshal([]byte(state.LastKey), &lastKey); err != nil {
+			return fmt.Errorf("failed to parse last key: %w", err)
+		}
+		// keys are either strings or integers, json decodes all numbers as float64
+		for i, value := range lastKey {
+			if f, ok := value.(float64); ok {
+				lastKey[i] = int64(f)
+			}
+		}
+	}
+
+	kinds, err := columnKindsOf(ctx, dst, table.Name)
+	if err != nil {
+		return err
+	}
+
+	keyColumns := strings.Join(table.Key, ", ")
+	for {
+		query := "SELECT * FROM " + table.Name
+		if lastKey != nil {
+			query += " WHERE (" + keyColumns + ") > (" + placeholders(1, len(table.Key)) + ")"
+		}
+		query += " ORDER BY " + keyColumns + " LIMIT " + strconv.Itoa(batchSize) + ";"
+
+		rows, err := src.QueryxContext(ctx, query, lastKey...)
+		if err != nil {
+			return fmt.Errorf("failed to read rows: %w", err)
+		}
+		var batch []map[string]any
+		for rows.Next() {
+			row := make(map[string]any)
+			if err = rows.MapScan(row); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("failed to scan row: %w", err)
+			}
+			batch = append(batch, row)
+		}
+		if err = rows.Close(); err != nil {
+			return fmt.Errorf("failed to read rows: %w", err)
+		}
+
+		done := len(batch) < batchSize
+		if len(batch) > 0 {
+			lastKey = make([]any, len(table.Key))
+			for i, column := range table.Key {
+				lastKey[i] = transferValue(batch[len(batch)-1][column], columnKindOther)
+			}
+		}
+		lastKeyData, err := json.Marshal(lastKey)
+		if err != nil {
+			return fmt.Errorf("failed to encode last key: %w", err)
+		}
+		state.Copied += int64(len(batch))
+
+		tx, err := dst.BeginTxx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err = insertTransferRows(ctx, tx, table.Name, kinds, batch); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if _, err = tx.ExecContext(ctx, "INSERT INTO "+transferProgressTable+" (table_name, last_key, copied, done) VALUES ($1, $2, $3, $4) ON CONFLICT (table_name) DO UPDATE SET last_key = excluded.last_key, copied = excluded.copied, done = excluded.done;", table.Name, string(lastKeyData), state.Copied, done); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to update progress: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit batch: %w", err)
+		}
+
+		if progress != nil {
+			progress(TransferProgress{
+				Table:  table.Name,
+				Copied: state.Copied,
+				Done:   done,
+			})
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// insertTransferRows inserts the rows with as few statements as the parameter limit allows, all rows have the same columns.
+func insertTransferRows(ctx context.Context, tx *sqlx.Tx, table string, kinds map[string]columnKind, rows []map[string]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := make([]string, 0, len(rows[0]))
+	for column := range rows[0] {
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+
+	for chunk := range slices.Chunk(rows, max(transferMaxArgs/len(columns), 1)) {
+		values := make([]string, len(chunk))
+		args := make([]any, 0, len(chunk)*len(columns))
+		for i, row := range chunk {
+			values[i] = "(" + placeholders(len(args)+1, len(columns)) + ")"
+			for _, column := range columns {
+				args = append(args, transferValue(row[column], kinds[column]))
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") VALUES "+strings.Join(values, ", ")+" ON CONFLICT DO NOTHING;", args...); err != nil {
+			return fmt.Errorf("failed to insert rows: %w", err)
+		}
+	}
+	return nil
+}
+
+// TransferChecksum is the number of rows and an order independent checksum of all rows of a table.
+type TransferChecksum struct {
+	Table    string `json:"table"`
+	Rows     int64  `json:"rows"`
+	Checksum uint64 `json:"checksum"`
+}
+
+// VerifyTransfer compares the row counts and checksums of all tables copied by Transfer and returns the checksums of the destination.
+// If both databases match the transfer progress is removed from the destination.
+func VerifyTransfer(ctx context.Context, from DB, to DB) ([]TransferChecksum, error) {
+	src, _, err := sqlxOf(from)
+	if err != nil {
+		return nil, err
+	}
+	dst, _, err := sqlxOf(to)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make([]TransferChecksum, 0, len(transferTables))
+	for _, table := range transferTables {
+		srcChecksum, err := checksumTable(ctx, src, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		dstChecksum, err := checksumTable(ctx, dst, table.Name)
+		if err != nil {
+			return nil, err
+		}
+		if srcChecksum.Rows != dstChecksum.Rows {
+			return nil, fmt.Errorf("table %s has %d rows in the source but %d rows in the destination", table.Name, srcChecksum.Rows, dstChecksum.Rows)
+		}
+		if srcChecksum.Checksum != dstChecksum.Checksum {
+			return nil, fmt.Errorf("table %s has checksum %x in the source but %x in the destination", table.Name, srcChecksum.Checksum, dstChecksum.Checksum)
+		}
+		checksums = append(checksums, dstChecksum)
+	}
+
+	if _, err = dst.ExecContext(ctx, "DROP TABLE IF EXISTS "+transferProgressTable+";"); err != nil {
+		return nil, fmt.Errorf("failed to drop transfer progress table: %w", err)
+	}
+	return checksums, nil
+}
+
+// checksumTable sums the SHA-256 hashes of all rows, so the checksum doesn't depend on the order of the rows which differs between databases.
+func checksumTable(ctx context.Context, q sqlx.QueryerContext, table string) (TransferChecksum, error) {
+	checksum := TransferChecksum{Table: table}
+
+	rows, err := q.QueryxContext(ctx, "SELECT * FROM "+table+";")
+	if err != nil {
+		return checksum, fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		row := make(map[string]any)
+		if err = rows.MapScan(row); err != nil {
+			return checksum, fmt.Errorf("failed to scan row of table %s: %w", table, err)
+		}
+		checksum.add(row)
+	}
+	if err = rows.Err(); err != nil {
+		return checksum, fmt.Errorf("failed to read table %s: %w", table, err)
+	}
+	return checksum, nil
+}
+
+// add adds a row to the checksum.
+func (c *TransferChecksum) add(row map[string]any) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	slices.Sort(columns)
+
+	h := sha256.New()
+	for _, column := range columns {
+		value := checksumValue(row[column])
+		_ = binary.Write(h, binary.BigEndian, int64(len(column)))
+		h.Write([]byte(column))
+		_ = binary.Write(h, binary.BigEndian, int64(len(value)))
+		h.Write(value)
+	}
+	c.Rows++
+	c.Checksum += binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// transferValue converts a value read from one database, so it is stored the same in the other one.
+// Times are stored in UTC, as PostgreSQL drops the time zone, and booleans stored as integers by SQLite are converted back.
+func transferValue(value any, kind columnKind) any {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC()
+	case int64:
+		if kind == columnKindBool {
+			return v != 0
+		}
+	}
+	return value
+}
+
+// checksumValue returns a representation of a value which is the same in SQLite and PostgreSQL.
+func checksumValue(value any) []byte {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case int64:
+		return []byte(strconv.FormatInt(v, 10))
+	case float64:
+		return []byte(strconv.FormatFloat(v, 'g', -1, 64))
+	case time.Time:
+		// PostgreSQL stores times with microsecond precision
+		return []byte(v.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano))
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
+
+type columnKind int
+
+const (
+	columnKindOther columnKind = iota
+	columnKindBool
+	columnKindBytes
+	columnKindTime
+)
+
+// columnKindsOf returns the kinds of the columns of a table, which can't be told apart by the values the database returns.
+func columnKindsOf(ctx context.Context, q sqlx.QueryerContext, table string) (map[string]columnKind, error) {
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+table+" LIMIT 0;")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
+	kinds := make(map[string]columnKind, len(columnTypes))
+	for _, columnType := range columnTypes {
+		switch strings.ToUpper(columnType.DatabaseTypeName()) {
+		case "BOOL", "BOOLEAN":
+			kinds[columnType.Name()] = columnKindBool
+		case "BLOB", "BYTEA":
+			kinds[columnType.Name()] = columnKindBytes
+		case "TIMESTAMP", "DATETIME", "DATE":
+			kinds[columnType.Name()] = columnKindTime
+		default:
+			kinds[columnType.Name()] = columnKindOther
+		}
+	}
+	return kinds, nil
+}
+
+// checkTransferTables makes sure all tables of the database are known to Transfer.
+func checkTransferTables(ctx context.Context, db *sqlx.DB, dbType Type) error {
+	tables, err := tablesOf(ctx, db, dbType)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if table == "gomigrate" || table == transferProgressTable {
+			continue
+		}
+		if !slices.ContainsFunc(transferTables, func(t transferTable) bool {
+			return t.Name == table
+		}) {
+			return fmt.Errorf("table %s is not supported by the transfer", table)
+		}
+	}
+	return nil
+}
+
+// checkTransferEmpty returns ErrTransferDestinationNotEmpty if any table of the database has rows.
+func checkTransferEmpty(ctx context.Context, q sqlx.QueryerContext) error {
+	for _, table := range transferTables {
+		var exists bool
+		if err := sqlx.GetContext(ctx, q, &exists, "SELECT EXISTS (SELECT 1 FROM "+table.Name+");"); err != nil {
+			return fmt.Errorf("failed to check table %s: %w", table.Name, err)
+		}
+		if exists {
+			return fmt.Errorf("%w: table %s has rows", ErrTransferDestinationNotEmpty, table.Name)
+		}
+	}
+	return nil
+}
+
+// tablesOf returns the names of all tables in the database.
+func tablesOf(ctx context.Context, db *sqlx.DB, dbType Type) ([]string, error) {
+	var (
+		tables []string
+		err    error
+	)
+	switch dbType {
+	case TypePostgres:
+		err = db.SelectContext(ctx, &tables, "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_type = 'BASE TABLE';")
+	case TypeSQLite:
+		err = db.SelectContext(ctx, &tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%';")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tables: %w", err)
+	}
+	return tables, nil
+}
+
+func sqlxOf(db DB) (*sqlx.DB, Type, error) {
+	switch d := db.(type) {
+	case *postgresDB:
+		return d.DB, TypePostgres, nil
+	case *sqliteDB:
+		return d.DB, TypeSQLite, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported database %T", db)
+	}
+}
+
+// placeholders returns count comma separated placeholders starting at $start.
+func placeholders(start int, count int) string {
+	p := make([]string, count)
+	for i := range p {
+		p[i] = "$" + strconv.Itoa(start+i)
+	}
+	return strings.Join(p, ", ")
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+	from := newTestDB(t, Config{})
+	to := newTestDB(t, Config{})
+
+	for _, content := range []string{"1", "2", "3"} {
+		if _, _, err := from.CreateDocument(ctx, []File{
+			{Name: "a.txt", Content: content, OrderIndex: 0},
+			{Name: "b.txt", Content: "b" + content, OrderIndex: 1},
+		}, DocumentAccess{Visibility: "public"}, nil); err != nil {
+			t.Fatalf("failed to create document: %s", err)
+		}
+	}
+
+	// a batch size smaller than the row count copies every table in multiple batches
+	if err := Transfer(ctx, from, to, 2, nil); err != nil {
+		t.Fatalf("failed to transfer: %s", err)
+	}
+	if _, err := VerifyTransfer(ctx, from, to); err != nil {
+		t.Fatalf("failed to verify transfer: %s", err)
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrDocumentVersionNotFound = errors.New("document version not found")
+
+const (
+	DiffStatusAdded   = "added"
+	DiffStatusRemoved = "removed"
+	DiffStatusRenamed = "renamed"
+	DiffStatusChanged = "changed"
+)
+
+type (
+	DiffResponse struct {
+		Key   string     `json:"key"`
+		From  int64      `json:"from"`
+		To    int64      `json:"to"`
+		Files []DiffFile `json:"files"`
+	}
+
+	DiffFile struct {
+		Name      string `json:"name"`
+		OldName   string `json:"old_name,omitempty"`
+		Status    string `json:"status"`
+		Diff      string `json:"diff"`
+		Formatted string `json:"formatted,omitempty"`
+	}
+)
+
+func (s *Server) GetDocumentDiff(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	query := r.URL.Query()
+
+	if err := checkUnscoped(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	from, err := s.resolveVersion(r, documentID, query.Get("from"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	to, err := s.resolveVersion(r, documentID, query.Get("to"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	from, to, err = s.resolveDiffVersions(r, documentID, from, to)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	files, err := s.diffVersions(r, documentID, from, to)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if accepts(r, "text/x-diff") {
+		w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeDiff)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		for _, file := range files {
+			_, _ = w.Write([]byte(file.Diff))
+		}
+		return
+	}
+
+	formatter, _ := getFormatter(r, false)
+	if formatter != nil {
+		style := getStyle(r)
+		for i, file := range files {
+			files[i].Formatted, err = s.formatFile(database.File{
+				Content:  file.Diff,
+				Language: "diff",
+			}, formatter, style)
+			if err != nil {
+				s.error(w, r, err)
+				return
+			}
+		}
+	}
+
+	s.ok(w, r, DiffResponse{
+		Key:   documentID,
+		From:  from,
+		To:    to,
+		Files: files,
+	})
+}
+
+// resolveDiffVersions replaces a missing to version with the latest version and a missing from version with the version before to.
+// If to is the original version from stays 0 and everything is diffed against an empty document.
+func (s *Server) resolveDiffVersions(r *http.Request, documentID string, from int64, to int64) (int64, int64, error) {
+	if from != 0 && to != 0 {
+		return from, to, nil
+	}
+
+	versions, err := s.db.GetDocumentVersions(r.Context(), documentID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return 0, 0, httperr.NotFound(ErrDocumentNotFound)
+	}
+
+	if to == 0 {
+		to = versions[0].Version
+	}
+	if from == 0 {
+		i := slices.IndexFunc(versions, func(version database.DocumentVersion) bool {
+			return version.Version == to
+		})
+		if i == -1 {
+			return 0, 0, httperr.NotFound(ErrDocumentVersionNotFound)
+		}
+		if i+1 < len(versions) {
+			from = versions[i+1].Version
+		}
+	}
+	return from, to, nil
+}
+
+func (s *Server) diffVersions(r *http.Request, documentID string, from int64, to int64) ([]DiffFile, error) {
+	var fromFiles []database.File
+	if from != 0 {
+		var err error
+		fromFiles, err = s.db.GetDocumentVersion(r.Context(), documentID, from)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, httperr.NotFound(ErrDocumentVersionNotFound)
+			}
+			return nil, fmt.Errorf("failed to get document version: %w", err)
+		}
+	}
+
+	toFiles, err := s.db.GetDocumentVersion(r.Context(), documentID, to)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrDocumentVersionNotFound)
+		}
+		return nil, fmt.Errorf("failed to get document version: %w", err)
+	}
+
+	return diffFiles(fromFiles, toFiles), nil
+}
+
+// diffFiles returns the git style diffs between two sets of files.
+// Unchanged files are omitted and removed files with the same content as an added file are treated as renamed.
+func diffFiles(from []database.File, to []database.File) []DiffFile {
+	var (
+		files   []DiffFile
+		removed []database.File
+	)
+	for _, oldFile := range from {
+		if !slices.ContainsFunc(to, func(file database.File) bool {
+			return file.Name == oldFile.Name
+		}) {
+			removed = append(removed, oldFile)
+		}
+	}
+
+	for _, newFile := range to {
+		i := slices.IndexFunc(from, func(file database.File) bool {
+			return file.Name == newFile.Name
+		})
+		if i != -1 {
+			if from[i].Content == newFile.Content {
+				continue
+			}
+			files = append(files, DiffFile{
+				Name:   newFile.Name,
+				Status: DiffStatusChanged,
+				Diff:   gitDiff(newFile.Name, newFile.Name, DiffStatusChanged, from[i].Content, newFile.Content),
+			})
+			continue
+		}
+
+		if ri := slices.IndexFunc(removed, func(file database.File) bool {
+			return file.Content == newFile.Content
+		}); ri != -1 {
+			oldName := removed[ri].Name
+			removed = slices.Delete(removed, ri, ri+1)
+			files = append(files, DiffFile{
+				Name:    newFile.Name,
+				OldName: oldName,
+				Status:  DiffStatusRenamed,
+				Diff:    gitDiff(oldName, newFile.Name, DiffStatusRenamed, newFile.Content, newFile.Content),
+			})
+			continue
+		}
+
+		files = append(files, DiffFile{
+			Name:   newFile.Name,
+			Status: DiffStatusAdded,
+			Diff:   gitDiff("", newFile.Name, DiffStatusAdded, "", newFile.Content),
+		})
+	}
+
+	for _, oldFile := range removed {
+		files = append(files, DiffFile{
+			Name:   oldFile.Name,
+			Status: DiffStatusRemoved,
+			Diff:   gitDiff(oldFile.Name, "", DiffStatusRemoved, oldFile.Content, ""),
+		})
+	}
+
+	return files
+}
+
+func gitDiff(oldName string, newName string, status string, oldContent string, newContent string) string {
+	a, b := oldName, newName
+	if a == "" {
+		a = b
+	}
+	if b == "" {
+		b = a
+	}
+
+	header := fmt.Sprintf("diff --git a/%s b/%s\n", a, b)
+	switch status {
+	case DiffStatusAdded:
+		header += "new file mode 100644\n"
+	case DiffStatusRemoved:
+		header += "deleted file mode 100644\n"
+	case DiffStatusRenamed:
+		header += fmt.Sprintf("similarity index 100%%\nrename from %s\nrename to %s\n", oldName, newName)
+	}
+	return header + diff.Unified(oldName, newName, oldContent, newContent)
+}
+
+// compareFiles returns the diff between the compare version and the given document as files highlighted with the diff lexer.
+func (s *Server) compareFiles(r *http.Request, document *database.Document, compare int64) ([]database.File, error) {
+	version := document.Version
+	if version == 0 {
+		version = document.Files[0].DocumentVersion
+	}
+
+	diffs, err := s.diffVersions(r, document.ID, compare, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diffs) == 0 {
+		return []database.File{{
+			Name:     "no changes",
+			Language: "Diff",
+		}}, nil
+	}
+
+	files := make([]database.File, len(diffs))
+	for i, file := range diffs {
+		files[i] = database.File{
+			Name:     file.Name,
+			Content:  file.Diff,
+			Language: "Diff",
+		}
+	}
+	return files, nil
+}
+
+// accepts reports whether the Accept header of the request explicitly lists the given media type.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, accept := range strings.Split(r.Header.Get(ezhttp.HeaderAccept), ",") {
+		if acceptType, _, err := mime.ParseMediaType(accept); err == nil && acceptType == mediaType {
+			return true
+		}
+	}
+	return false
+}
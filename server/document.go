@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
 	"mime"
 	"mime/multipart"
 	"net/http"
@@ -19,6 +20,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/topi314/chroma/v2"
 	"github.com/topi314/chroma/v2/formatters"
 	"github.com/topi314/chroma/v2/lexers"
@@ -39,7 +41,21 @@ var (
 	ErrDocumentTooLarge           = func(maxLength int64) error {
 		return fmt.Errorf("document too large, must be less than %d chars", maxLength)
 	}
-	ErrInvalidExpiresAt = errors.New("invalid expires_at, must be in the future")
+	ErrInvalidExpiresAt       = errors.New("invalid expires_at, must be in the future")
+	ErrInvalidExpiresIn       = errors.New("invalid expires_in, must be a positive duration")
+	ErrConflictingExpiry      = errors.New("only one of expires_in and expires_at can be set")
+	ErrInvalidBaseVersion     = errors.New("invalid base version")
+	ErrDocumentVersionChanged = errors.New("document has been updated since the base version")
+	ErrMessageTooLong         = fmt.Errorf("message too long, must be less than %d chars", maxMessageLength)
+	ErrInvalidVersionsBefore  = errors.New("invalid before, must be a version")
+	ErrInvalidVersionsLimit   = fmt.Errorf("invalid limit, must be between 1 and %d", maxVersionsLimit)
+)
+
+const (
+	maxMessageLength             = 1024
+	maxVersionLabelMessageLength = 50
+	defaultVersionsLimit         = 50
+	maxVersionsLimit             = 500
 )
 
 var VersionTimeFormat = "2006-01-02 15:04:05"
@@ -50,10 +66,17 @@ type (
 		Version      int64          `json:"version"`
 		VersionLabel string         `json:"version_label,omitempty"`
 		VersionTime  string         `json:"version_time,omitempty"`
+		Message      string         `json:"message,omitempty"`
+		ForkedFrom   *ForkResponse  `json:"forked_from,omitempty"`
 		Files        []ResponseFile `json:"files"`
 		Token        string         `json:"token,omitempty"`
 	}
 
+	ForkResponse struct {
+		Key     string `json:"key"`
+		Version int64  `json:"version"`
+	}
+
 	ResponseFile struct {
 		Name      string     `json:"name"`
 		Content   string     `json:"content,omitempty"`
@@ -71,63 +94,228 @@ type (
 
 	DeleteResponse struct {
 		Versions int `json:"versions"`
+		// PurgeAt is when a document in the trash is deleted
+		PurgeAt *time.Time `json:"purge_at,omitempty"`
 	}
 
 	ShareRequest struct {
 		Permissions []string `json:"permissions"`
+		// ExpiresIn is a duration like 24h after which the token expires
+		ExpiresIn *string    `json:"expires_in,omitempty"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+		// Version restricts the token to a version number or tag, tags are resolved when sharing
+		Version string   `json:"version,omitempty"`
+		Files   []string `json:"files,omitempty"`
 	}
 
 	ShareResponse struct {
-		Token string `json:"token"`
+		Token     string     `json:"token"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}
+
+	DocumentVersionsResponse struct {
+		Key        string                    `json:"key"`
+		Versions   []DocumentVersionResponse `json:"versions"`
+		NextBefore int64                     `json:"next_before,omitempty"`
+	}
+
+	DocumentVersionResponse struct {
+		Version      int64                 `json:"version"`
+		VersionLabel string                `json:"version_label"`
+		VersionTime  string                `json:"version_time"`
+		Message      string                `json:"message,omitempty"`
+		Tags         []string              `json:"tags,omitempty"`
+		Files        []VersionFileResponse `json:"files"`
+	}
+
+	VersionFileResponse struct {
+		Name      string `json:"name"`
+		Language  string `json:"language"`
+		Size      int    `json:"size"`
+		Lines     int    `json:"lines"`
+		Content   string `json:"content,omitempty"`
+		Formatted string `json:"formatted,omitempty"`
+	}
+
+	ConflictResponse struct {
+		ezhttp.ErrorResponse
+		Current   DocumentResponse    `json:"current"`
+		Conflicts []MergeConflictFile `json:"conflicts,omitempty"`
 	}
 )
 
+// DocumentVersions returns a page of the versions of a document from newest to oldest.
+// The next page can be requested with the next_before cursor of the response.
 func (s *Server) DocumentVersions(w http.ResponseWriter, r *http.Request) {
 	documentID := chi.URLParam(r, "documentID")
-	withContent := r.URL.Query().Get("withContent") == "true"
+	query := r.URL.Query()
+	withContent := query.Get("withContent") == "true"
 
-	versions, err := s.db.GetDocumentVersionsWithFiles(r.Context(), documentID, withContent)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			s.error(w, r, httperr.NotFound(err))
+	var before int64
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		var err error
+		before, err = strconv.ParseInt(beforeStr, 10, 64)
+		if err != nil || before <= 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidVersionsBefore))
+			return
+		}
+	}
+
+	limit := defaultVersionsLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxVersionsLimit {
+			s.error(w, r, httperr.BadRequest(ErrInvalidVersionsLimit))
 			return
 		}
-		s.error(w, r, fmt.Errorf("failed to get document versions: %w", err))
+	}
+
+	response, err := s.getDocumentVersions(r, documentID, before, limit, withContent)
+	if err != nil {
+		s.error(w, r, err)
 		return
 	}
 
-	formatter, _ := getFormatter(r, false)
-	style := getStyle(r)
+	s.ok(w, r, response)
+}
 
-	var response []DocumentResponse
-	for version, dbFiles := range versions {
-		files := make([]ResponseFile, len(dbFiles))
-		for i, file := range dbFiles {
-			var formatted string
-			if withContent {
-				formatted, err = s.formatFile(file, formatter, style)
-				if err != nil {
-					s.error(w, r, err)
-					return
-				}
+// getDocumentVersions returns up to limit versions older than before or the newest versions if before is 0.
+// Tokens scoped to a version only see that version and tokens scoped to files only see those files.
+func (s *Server) getDocumentVersions(r *http.Request, documentID string, before int64, limit int, withContent bool) (*DocumentVersionsResponse, error) {
+	scope := getScope(r, documentID)
+	if scope != nil && scope.Version != 0 {
+		if before != 0 && before <= scope.Version {
+			return &DocumentVersionsResponse{
+				Key:      documentID,
+				Versions: []DocumentVersionResponse{},
+			}, nil
+		}
+		before, limit = scope.Version+1, 1
+	}
+
+	dbBefore := before
+	if dbBefore == 0 {
+		dbBefore = math.MaxInt64
+	}
+	// fetch one more version to know whether there is a next page
+	dbFiles, err := s.db.GetDocumentVersionsWithFiles(r.Context(), documentID, dbBefore, limit+1, withContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document versions: %w", err)
+	}
+	if len(dbFiles) == 0 && before == 0 {
+		return nil, httperr.NotFound(ErrDocumentNotFound)
+	}
+	if scope != nil && scope.Version != 0 && (len(dbFiles) == 0 || dbFiles[0].DocumentVersion != scope.Version) {
+		// the scoped version was deleted, older versions must not be listed instead
+		return nil, httperr.NotFound(ErrDocumentVersionNotFound)
+	}
+
+	// the list is filtered by the scope, so the head and the original version are looked up separately
+	var headVersion, originalVersion int64
+	if scope == nil {
+		if before == 0 && len(dbFiles) > 0 {
+			headVersion = dbFiles[0].DocumentVersion
+		}
+	} else {
+		head, err := s.db.GetDocumentVersionsWithFiles(r.Context(), documentID, math.MaxInt64, 1, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get document head version: %w", err)
+		}
+		if len(head) > 0 {
+			headVersion = head[0].DocumentVersion
+		}
+	}
+	if versions := countVersions(dbFiles); versions > 0 && versions <= limit {
+		originalVersion = dbFiles[len(dbFiles)-1].DocumentVersion
+	}
+
+	tags, err := s.db.GetDocumentTags(r.Context(), documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document tags: %w", err)
+	}
+	versionTags := make(map[int64][]string)
+	for _, tag := range tags {
+		versionTags[tag.DocumentVersion] = append(versionTags[tag.DocumentVersion], tag.Name)
+	}
+
+	var (
+		formatter chroma.Formatter
+		style     *chroma.Style
+	)
+	if withContent {
+		formatter, _ = getFormatter(r, false)
+		style = getStyle(r)
+	}
+
+	response := DocumentVersionsResponse{
+		Key:      documentID,
+		Versions: []DocumentVersionResponse{},
+	}
+	for _, file := range dbFiles {
+		if !scope.HasFile(file.Name) {
+			continue
+		}
+		if len(response.Versions) == 0 || response.Versions[len(response.Versions)-1].Version != file.DocumentVersion {
+			if len(response.Versions) == limit {
+				response.NextBefore = response.Versions[len(response.Versions)-1].Version
+				break
 			}
+			response.Versions = append(response.Versions, DocumentVersionResponse{
+				Version:     file.DocumentVersion,
+				VersionTime: time.UnixMilli(file.DocumentVersion).Format(VersionTimeFormat),
+				Message:     file.Message,
+				Tags:        versionTags[file.DocumentVersion],
+			})
+		}
 
-			files[i] = ResponseFile{
-				Name:      file.Name,
-				Content:   file.Content,
-				Formatted: formatted,
-				Language:  file.Language,
-				ExpiresAt: file.ExpiresAt,
+		var formatted string
+		if withContent {
+			formatted, err = s.formatFile(file.File, formatter, style)
+			if err != nil {
+				return nil, err
 			}
 		}
-		response = append(response, DocumentResponse{
-			Key:     documentID,
-			Version: version,
-			Files:   nil,
+
+		version := &response.Versions[len(response.Versions)-1]
+		version.Files = append(version.Files, VersionFileResponse{
+			Name:      file.Name,
+			Language:  file.Language,
+			Size:      file.Size,
+			Lines:     file.Lines,
+			Content:   file.Content,
+			Formatted: formatted,
 		})
 	}
 
-	s.ok(w, r, response)
+	if scope != nil && scope.Version != 0 {
+		// the scoped version is the only one the token can see
+		response.NextBefore = 0
+	}
+
+	for i := range response.Versions {
+		version := &response.Versions[i]
+		var suffix string
+		if version.Version == headVersion {
+			suffix = " (current)"
+		} else if version.Version == originalVersion {
+			suffix = " (original)"
+		}
+		version.VersionLabel = versionLabel(time.UnixMilli(version.Version), suffix, version.Message, version.Tags)
+	}
+
+	return &response, nil
+}
+
+// countVersions returns the number of versions of the files, which are ordered by version.
+func countVersions(files []database.VersionFile) int {
+	var count int
+	for i, file := range files {
+		if i == 0 || files[i-1].DocumentVersion != file.DocumentVersion {
+			count++
+		}
+	}
+	return count
 }
 
 func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
@@ -158,11 +346,23 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	versions, err := s.db.GetDocumentVersions(r.Context(), document.ID)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		s.prettyError(w, r, fmt.Errorf("failed to get document versions: %w", err))
+	compare, err := s.resolveVersion(r, document.ID, r.URL.Query().Get("compare"))
+	if err != nil {
+		s.prettyError(w, r, err)
 		return
 	}
+	files := document.Files
+	if compare != 0 && document.ID != "" {
+		if err = checkUnscoped(r, document.ID); err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+		files, err = s.compareFiles(r, document, compare)
+		if err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+	}
 
 	formatter, _ := getFormatter(r, true)
 	style := getStyle(r)
@@ -172,8 +372,8 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		currentFile int
 		totalLength int
 	)
-	templateFiles := make([]templates.File, len(document.Files))
-	for i, file := range document.Files {
+	templateFiles := make([]templates.File, len(files))
+	for i, file := range files {
 		formatted, err := s.formatFile(file, formatter, style)
 		if err != nil {
 			s.prettyError(w, r, err)
@@ -191,27 +391,63 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		totalLength += len([]rune(file.Content))
 	}
 
-	templateVersions := make([]templates.DocumentVersion, len(versions))
-	for i, v := range versions {
-		versionTime := time.UnixMilli(v)
-		versionLabel := humanize.Time(versionTime)
-		if i == 0 {
-			versionLabel += " (current)"
-		} else if i == len(versions)-1 {
-			versionLabel += " (original)"
+	// only the newest versions are rendered, older ones are loaded on demand
+	versions := &DocumentVersionsResponse{}
+	if document.ID != "" {
+		versions, err = s.getDocumentVersions(r, document.ID, 0, defaultVersionsLimit, false)
+		if err != nil {
+			s.prettyError(w, r, err)
+			return
 		}
+		for _, version := range []int64{document.Version, compare} {
+			if version == 0 || slices.ContainsFunc(versions.Versions, func(v DocumentVersionResponse) bool { return v.Version == version }) {
+				continue
+			}
+			olderVersions, err := s.getDocumentVersions(r, document.ID, version+1, 1, false)
+			if err != nil {
+				s.prettyError(w, r, err)
+				return
+			}
+			versions.Versions = append(versions.Versions, olderVersions.Versions...)
+		}
+	}
+
+	var forkedFrom *ForkResponse
+	if document.ID != "" {
+		forkedFrom, err = s.getDocumentFork(r, document.ID)
+		if err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+	}
+
+	templateVersions := make([]templates.DocumentVersion, len(versions.Versions))
+	for i, v := range versions.Versions {
 		templateVersions[i] = templates.DocumentVersion{
-			Version: v,
-			Label:   versionLabel,
-			Time:    versionTime.Format(VersionTimeFormat),
+			Version: v.Version,
+			Label:   v.VersionLabel,
+			Time:    v.VersionTime,
+			Message: v.Message,
 		}
 	}
 
+	access := database.DocumentAccess{Visibility: string(VisibilityPublic)}
+	if document.ID != "" {
+		documentAccess, err := s.db.GetDocumentAccess(r.Context(), document.ID)
+		if err != nil {
+			s.prettyError(w, r, err)
+			return
+		}
+		access = *documentAccess
+	}
+	visibility := Visibility(access.Visibility)
+
 	var (
 		previewURL string
 		previewAlt string
 	)
-	if s.cfg.Preview.Enabled {
+	// previews of private and password protected documents can't be loaded without a token and would reveal their content
+	if s.cfg.Preview.Enabled && visibility == VisibilityPublic && access.PasswordHash == nil {
 		previewURL = "https://" + r.Host + "/" + document.ID
 		if version := chi.URLParam(r, "version"); version != "" {
 			previewURL += "/" + version
@@ -232,6 +468,10 @@ func (s *Server) GetPrettyDocument(w http.ResponseWriter, r *http.Request) {
 		CurrentFile: currentFile,
 		TotalLength: totalLength,
 		Versions:    templateVersions,
+		NextBefore:  versions.NextBefore,
+		Compare:     compare,
+		ForkedFrom:  templateFork(forkedFrom),
+		Private:     visibility == VisibilityPrivate,
 
 		Lexers: lexers.Names(false),
 		Styles: s.styles,
@@ -253,6 +493,7 @@ func (s *Server) GetDocument(w http.ResponseWriter, r *http.Request) {
 		s.error(w, r, err)
 		return
 	}
+	w.Header().Set(ezhttp.HeaderETag, formatETag(document.Files[0].DocumentVersion))
 
 	formatter, _ := getFormatter(r, false)
 	style := getStyle(r)
@@ -286,10 +527,18 @@ func (s *Server) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	forkedFrom, err := s.getDocumentFork(r, document.ID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
 	response := DocumentResponse{
-		Key:     document.ID,
-		Version: document.Version,
-		Files:   make([]ResponseFile, len(document.Files)),
+		Key:        document.ID,
+		Version:    document.Version,
+		Message:    document.Files[0].Message,
+		ForkedFrom: forkedFrom,
+		Files:      make([]ResponseFile, len(document.Files)),
 	}
 	for i, file := range document.Files {
 		formatted, err := s.formatFile(file, formatter, style)
@@ -475,19 +724,20 @@ func (s *Server) getDocument(r *http.Request, fallbackURL func(documentID string
 		return nil, httperr.NotFound(ErrDocumentNotFound)
 	}
 
-	var version int64
-	if versionStr := chi.URLParam(r, "version"); versionStr != "" {
-		var err error
-		version, err = strconv.ParseInt(versionStr, 10, 64)
-		if err != nil {
-			return nil, httperr.BadRequest(ErrInvalidDocumentVersion)
+	version, err := s.resolveVersion(r, documentID, chi.URLParam(r, "version"))
+	if err != nil {
+		if fallbackURL != nil && errors.Is(err, ErrDocumentVersionNotFound) {
+			return nil, httperr.Found(fallbackURL(documentID))
 		}
+		return nil, err
 	}
 
-	var (
-		files []database.File
-		err   error
-	)
+	scope := getScope(r, documentID)
+	if version, err = scopeVersion(scope, version); err != nil {
+		return nil, err
+	}
+
+	var files []database.File
 	if version == 0 {
 		files, err = s.db.GetDocument(r.Context(), documentID)
 	} else {
@@ -503,6 +753,10 @@ func (s *Server) getDocument(r *http.Request, fallbackURL func(documentID string
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
 
+	if files = scopeFiles(scope, files); len(files) == 0 {
+		return nil, httperr.NotFound(ErrDocumentNotFound)
+	}
+
 	return &database.Document{
 		ID:      documentID,
 		Version: version,
@@ -603,25 +857,22 @@ func (s *Server) getDocumentFile(r *http.Request) (*database.File, error) {
 		return nil, httperr.NotFound(ErrDocumentFileNotFound)
 	}
 
-	versionStr := chi.URLParam(r, "version")
-	var version int64
-	if versionStr != "" {
-		var err error
-		version, err = strconv.ParseInt(versionStr, 10, 64)
-		if err != nil {
-			return nil, httperr.BadRequest(ErrInvalidDocumentVersion)
-		}
+	version, err := s.resolveVersion(r, documentID, chi.URLParam(r, "version"))
+	if err != nil {
+		return nil, err
+	}
+
+	scope := getScope(r, documentID)
+	if version, err = scopeVersion(scope, version); err != nil {
+		return nil, err
 	}
 
 	fileName := chi.URLParam(r, "fileName")
-	if fileName == "" {
+	if fileName == "" || !scope.HasFile(fileName) {
 		return nil, httperr.NotFound(ErrDocumentFileNotFound)
 	}
 
-	var (
-		file *database.File
-		err  error
-	)
+	var file *database.File
 	if version == 0 {
 		file, err = s.db.GetDocumentFile(r.Context(), documentID, fileName)
 	} else {
@@ -638,7 +889,19 @@ func (s *Server) getDocumentFile(r *http.Request) (*database.File, error) {
 }
 
 func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
-	files, err := s.parseDocumentFiles(r)
+	files, message, err := s.parseDocumentFiles(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	visibility, err := getVisibility(r.URL.Query(), VisibilityPublic)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	passwordHash, err := getPasswordHash(r.Header.Get(ezhttp.HeaderPassword))
 	if err != nil {
 		s.error(w, r, err)
 		return
@@ -652,15 +915,32 @@ func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
 			Language:   file.Language,
 			ExpiresAt:  file.ExpiresAt,
 			OrderIndex: i,
+			Message:    message,
 		})
 	}
 
-	documentID, version, err := s.db.CreateDocument(r.Context(), dbFiles)
+	s.createDocument(w, r, dbFiles, message, database.DocumentAccess{
+		Visibility:   string(visibility),
+		PasswordHash: passwordHash,
+	}, nil)
+}
+
+// createDocument stores the files as a new document, records the document it was forked from if any and writes the document with a new token as response.
+func (s *Server) createDocument(w http.ResponseWriter, r *http.Request, dbFiles []database.File, message string, access database.DocumentAccess, fork *database.DocumentFork) {
+	documentID, version, err := s.db.CreateDocument(r.Context(), dbFiles, access, fork)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to create document: %w", err))
 		return
 	}
 
+	var forkedFrom *ForkResponse
+	if fork != nil {
+		forkedFrom = &ForkResponse{
+			Key:     fork.ParentDocumentID,
+			Version: fork.ParentDocumentVersion,
+		}
+	}
+
 	formatter, _ := getFormatter(r, false)
 	style := getStyle(r)
 
@@ -680,7 +960,7 @@ func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	token, err := s.NewToken(*documentID, AllPermissions)
+	token, err := s.NewToken(r.Context(), *documentID, AllPermissions, "", nil, nil)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to create jwt token: %w", err))
 		return
@@ -690,28 +970,41 @@ func (s *Server) PostDocument(w http.ResponseWriter, r *http.Request) {
 	s.json(w, r, DocumentResponse{
 		Key:          *documentID,
 		Version:      *version,
-		VersionLabel: humanize.Time(versionTime) + " (original)",
+		VersionLabel: versionLabel(versionTime, " (original)", message, nil),
 		VersionTime:  versionTime.Format(VersionTimeFormat),
+		Message:      message,
+		ForkedFrom:   forkedFrom,
 		Files:        rsFiles,
 		Token:        token,
 	}, http.StatusCreated)
-
 }
 
 func (s *Server) PatchDocument(w http.ResponseWriter, r *http.Request) {
-	files, err := s.parseDocumentFiles(r)
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	files, message, err := s.parseDocumentFiles(r)
 	if err != nil {
 		s.error(w, r, err)
 		return
 	}
 
-	claims := GetClaims(r)
-	if flags.Misses(claims.Permissions, PermissionWrite) {
-		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+	baseVersion, err := getBaseVersion(r)
+	if err != nil {
+		s.error(w, r, err)
 		return
 	}
 
-	documentID := chi.URLParam(r, "documentID")
+	current, err := s.getLatestDocumentFiles(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
 
 	var dbFiles []database.File
 	for i, file := range files {
@@ -721,11 +1014,113 @@ func (s *Server) PatchDocument(w http.ResponseWriter, r *http.Request) {
 			Language:   file.Language,
 			ExpiresAt:  file.ExpiresAt,
 			OrderIndex: i,
+			Message:    message,
 		})
 	}
 
-	version, err := s.db.UpdateDocument(r.Context(), documentID, dbFiles)
+	if baseVersion != 0 {
+		if current[0].DocumentVersion != baseVersion {
+			base, err := s.db.GetDocumentVersion(r.Context(), documentID, baseVersion)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					s.conflict(w, r, documentID, current, nil)
+					return
+				}
+				s.error(w, r, fmt.Errorf("failed to get document base version: %w", err))
+				return
+			}
+
+			var conflicts []MergeConflictFile
+			dbFiles, conflicts = mergeFiles(base, current, dbFiles)
+			if len(conflicts) > 0 || len(dbFiles) == 0 {
+				s.conflict(w, r, documentID, current, conflicts)
+				return
+			}
+			// the merged files are based on the current version, so it must still be the head when they are stored
+			baseVersion = current[0].DocumentVersion
+		}
+	}
+
+	s.updateDocument(w, r, documentID, dbFiles, message, baseVersion)
+}
+
+// conflict writes a 409 Conflict response containing the current version of the document and the merge conflicts if any.
+// The current version is only included if the token can read the whole document.
+func (s *Server) conflict(w http.ResponseWriter, r *http.Request, documentID string, current []database.File, conflicts []MergeConflictFile) {
+	conflictErr := ErrDocumentVersionChanged
+	if len(conflicts) > 0 {
+		conflictErr = ErrMergeConflict
+	}
+
+	claims := GetClaims(r)
+	if !canRead(claims, documentID) || claims.Scope != nil {
+		s.error(w, r, httperr.Conflict(conflictErr))
+		return
+	}
+
+	formatter, _ := getFormatter(r, false)
+	style := getStyle(r)
+
+	rsFiles := make([]ResponseFile, len(current))
+	for i, file := range current {
+		formatted, err := s.formatFile(file, formatter, style)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		rsFiles[i] = ResponseFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Formatted: formatted,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+
+	version := current[0].DocumentVersion
+	versionTime := time.UnixMilli(version)
+	w.Header().Set(ezhttp.HeaderETag, formatETag(version))
+	s.json(w, r, ConflictResponse{
+		ErrorResponse: ezhttp.ErrorResponse{
+			Message:   conflictErr.Error(),
+			Status:    http.StatusConflict,
+			Path:      r.URL.Path,
+			RequestID: middleware.GetReqID(r.Context()),
+		},
+		Current: DocumentResponse{
+			Key:          documentID,
+			Version:      version,
+			VersionLabel: versionLabel(versionTime, " (current)", current[0].Message, nil),
+			VersionTime:  versionTime.Format(VersionTimeFormat),
+			Message:      current[0].Message,
+			Files:        rsFiles,
+		},
+		Conflicts: conflicts,
+	}, http.StatusConflict)
+}
+
+// updateDocument stores the files as a new document version with the given message, executes the update webhooks and writes the new version as response.
+// If baseVersion is not 0 the document is only updated if its head is still at that version, otherwise a conflict is written.
+func (s *Server) updateDocument(w http.ResponseWriter, r *http.Request, documentID string, dbFiles []database.File, message string, baseVersion int64) {
+	for i := range dbFiles {
+		dbFiles[i].Message = message
+	}
+
+	version, err := s.db.UpdateDocument(r.Context(), documentID, dbFiles, baseVersion)
 	if err != nil {
+		if errors.Is(err, database.ErrHeadVersionChanged) {
+			current, err := s.getLatestDocumentFiles(r, documentID)
+			if err != nil {
+				s.error(w, r, err)
+				return
+			}
+			s.conflict(w, r, documentID, current, nil)
+			return
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
 		s.error(w, r, fmt.Errorf("failed to update document: %w", err))
 		return
 	}
@@ -749,75 +1144,209 @@ func (s *Server) PatchDocument(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	webhooksFiles := make([]WebhookDocumentFile, len(files))
-	for i, file := range files {
-		webhooksFiles[i] = WebhookDocumentFile(file)
+	webhooksFiles := make([]WebhookDocumentFile, len(dbFiles))
+	for i, file := range dbFiles {
+		webhooksFiles[i] = WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}
 	}
 	s.ExecuteWebhooks(r.Context(), WebhookEventUpdate, WebhookDocument{
 		Key:     documentID,
 		Version: *version,
+		Message: message,
 		Files:   webhooksFiles,
 	})
 
 	versionTime := time.UnixMilli(*version)
+	w.Header().Set(ezhttp.HeaderETag, formatETag(*version))
 	s.json(w, r, DocumentResponse{
 		Key:          documentID,
 		Version:      *version,
-		VersionLabel: humanize.Time(versionTime) + " (current)",
+		VersionLabel: versionLabel(versionTime, " (current)", message, nil),
 		VersionTime:  versionTime.Format(VersionTimeFormat),
+		Message:      message,
 		Files:        rsFiles,
 	}, http.StatusOK)
 }
 
-func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
+// PostDocumentVersionRestore creates a new document version with the files of an older version.
+func (s *Server) PostDocumentVersionRestore(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
 	claims := GetClaims(r)
-	if flags.Misses(claims.Permissions, PermissionDelete) {
-		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("webhook")))
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
 		return
 	}
 
+	version, err := s.resolveVersion(r, documentID, chi.URLParam(r, "version"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	files, err := s.db.GetDocumentVersion(r.Context(), documentID, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentVersionNotFound))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to get document version: %w", err))
+		return
+	}
+
+	message := r.Header.Get(ezhttp.HeaderMessage)
+	if message == "" {
+		message = fmt.Sprintf("Restore version %d", version)
+	}
+	s.updateDocument(w, r, documentID, orderFiles(files), message, 0)
+}
+
+// getDocumentFork returns the document and version the document was forked from or nil if it isn't a fork.
+func (s *Server) getDocumentFork(r *http.Request, documentID string) (*ForkResponse, error) {
+	fork, err := s.db.GetDocumentFork(r.Context(), documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get document fork: %w", err)
+	}
+	return &ForkResponse{
+		Key:     fork.ParentDocumentID,
+		Version: fork.ParentDocumentVersion,
+	}, nil
+}
+
+func templateFork(fork *ForkResponse) *templates.Fork {
+	if fork == nil {
+		return nil
+	}
+	return &templates.Fork{
+		Key:     fork.Key,
+		Version: fork.Version,
+	}
+}
+
+// PostDocumentFork creates a new document with the files of a document version, the new document records which document and version it was forked from.
+func (s *Server) PostDocumentFork(w http.ResponseWriter, r *http.Request) {
 	documentID := chi.URLParam(r, "documentID")
-	var version int64
-	if versionStr := chi.URLParam(r, "version"); versionStr != "" {
-		var err error
-		version, err = strconv.ParseInt(versionStr, 10, 64)
+	if err := s.checkRead(w, r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	document, err := s.getDocument(r, nil)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	// forks of private documents stay private unless requested otherwise, forks of password protected documents keep the password
+	parentAccess, err := s.db.GetDocumentAccess(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	visibility, err := getVisibility(r.URL.Query(), Visibility(parentAccess.Visibility))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	expiresAt, err := getExpiresAt(r.URL.Query(), r.Header)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	message := r.Header.Get(ezhttp.HeaderMessage)
+	if len(message) > maxMessageLength {
+		s.error(w, r, httperr.BadRequest(ErrMessageTooLong))
+		return
+	}
+
+	dbFiles := make([]database.File, len(document.Files))
+	for i, file := range document.Files {
+		dbFiles[i] = database.File{
+			Name:       file.Name,
+			Content:    file.Content,
+			Language:   file.Language,
+			ExpiresAt:  expiresAt,
+			OrderIndex: i,
+			Message:    message,
+		}
+	}
+
+	s.createDocument(w, r, dbFiles, message, database.DocumentAccess{
+		Visibility:   string(visibility),
+		PasswordHash: parentAccess.PasswordHash,
+	}, &database.DocumentFork{
+		ParentDocumentID:      document.ID,
+		ParentDocumentVersion: document.Files[0].DocumentVersion,
+	})
+}
+
+// DeleteDocument moves a document to the trash or deletes a document version.
+// Documents are deleted immediately with the purge query parameter or if the delete grace period is disabled.
+func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionDelete) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("delete")))
+		return
+	}
+
+	version, err := s.resolveVersion(r, documentID, chi.URLParam(r, "version"))
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	purge := r.URL.Query().Has("purge")
+	if version == 0 && !purge && s.cfg.Database.DeleteGracePeriod > 0 {
+		deletedAt, err := s.db.TrashDocument(r.Context(), documentID)
 		if err != nil {
-			s.error(w, r, httperr.BadRequest(ErrInvalidDocumentVersion))
+			if errors.Is(err, sql.ErrNoRows) {
+				s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+				return
+			}
+			s.error(w, r, fmt.Errorf("failed to trash document: %w", err))
 			return
 		}
+
+		purgeAt := deletedAt.Add(time.Duration(s.cfg.Database.DeleteGracePeriod))
+		s.ok(w, r, DeleteResponse{
+			PurgeAt: &purgeAt,
+		})
+		return
 	}
 
-	var (
-		document *database.Document
-		err      error
-	)
+	var document *database.Document
 	if version == 0 {
 		document, err = s.db.DeleteDocument(r.Context(), documentID)
 	} else {
 		document, err = s.db.DeleteDocumentVersion(r.Context(), documentID, version)
 	}
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) && version != 0 {
+			s.error(w, r, httperr.NotFound(ErrDocumentVersionNotFound))
+			return
+		} else if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
 		s.error(w, r, fmt.Errorf("failed to delete document: %w", err))
 		return
 	}
 
-	webhooksFiles := make([]WebhookDocumentFile, len(document.Files))
-	for i, file := range document.Files {
-		webhooksFiles[i] = WebhookDocumentFile{
-			Name:      file.Name,
-			Content:   file.Content,
-			Language:  file.Language,
-			ExpiresAt: file.ExpiresAt,
-		}
-	}
-	s.ExecuteWebhooks(r.Context(), WebhookEventDelete, WebhookDocument{
-		Key:     document.ID,
-		Version: document.Version,
-		Files:   webhooksFiles,
-	})
-
 	if version == 0 {
+		s.ExecuteWebhooks(r.Context(), WebhookEventDelete, newWebhookDocument(*document))
 		s.ok(w, r, nil)
+		return
 	}
 
 	count, err := s.db.GetVersionCount(r.Context(), documentID)
@@ -825,11 +1354,41 @@ func (s *Server) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 		s.error(w, r, err)
 		return
 	}
+
+	// deleting the last version deletes the document
+	event := WebhookEventVersionDelete
+	if count == 0 {
+		event = WebhookEventDelete
+	}
+	s.ExecuteWebhooks(r.Context(), event, newWebhookDocument(*document))
+
 	s.ok(w, r, DeleteResponse{
 		Versions: count,
 	})
 }
 
+// PostDocumentRestore moves a document out of the trash.
+func (s *Server) PostDocumentRestore(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionDelete) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("delete")))
+		return
+	}
+
+	if err := s.db.RestoreDocument(r.Context(), documentID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotInTrash))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to restore document: %w", err))
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
 func (s *Server) PostDocumentShare(w http.ResponseWriter, r *http.Request) {
 	documentID := chi.URLParam(r, "documentID")
 
@@ -863,36 +1422,86 @@ func (s *Server) PostDocumentShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := s.NewToken(documentID, perms)
+	expiresAt, err := getShareExpiresAt(shareRequest, claims)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	scope, err := s.getShareScope(r, documentID, shareRequest, perms)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	token, err := s.NewToken(r.Context(), documentID, perms, claims.ID, expiresAt, scope)
 	if err != nil {
 		s.error(w, r, fmt.Errorf("failed to create new token: %w", err))
 		return
 	}
 
-	s.ok(w, r, ShareResponse{Token: token})
+	s.ok(w, r, ShareResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
 }
 
-func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
+// getShareExpiresAt returns when a shared token expires. A token can't outlive the token it was shared with,
+// so the expiry of the sharing token is used if it expires earlier.
+func getShareExpiresAt(shareRequest ShareRequest, claims Claims) (*time.Time, error) {
+	var expiresAt *time.Time
+	switch {
+	case shareRequest.ExpiresIn != nil && shareRequest.ExpiresAt != nil:
+		return nil, httperr.BadRequest(ErrConflictingExpiry)
+	case shareRequest.ExpiresIn != nil:
+		expiresIn, err := time.ParseDuration(*shareRequest.ExpiresIn)
+		if err != nil || expiresIn <= 0 {
+			return nil, httperr.BadRequest(ErrInvalidExpiresIn)
+		}
+		t := time.Now().Add(expiresIn)
+		expiresAt = &t
+	case shareRequest.ExpiresAt != nil:
+		if shareRequest.ExpiresAt.Before(time.Now()) {
+			return nil, httperr.BadRequest(ErrInvalidExpiresAt)
+		}
+		expiresAt = shareRequest.ExpiresAt
+	}
+
+	if claims.Expiry != nil {
+		if issuerExpiresAt := claims.Expiry.Time(); expiresAt == nil || issuerExpiresAt.Before(*expiresAt) {
+			expiresAt = &issuerExpiresAt
+		}
+	}
+	if expiresAt != nil {
+		t := expiresAt.UTC().Truncate(time.Second)
+		expiresAt = &t
+	}
+	return expiresAt, nil
+}
+
+// parseDocumentFiles parses the files and the optional version message of a document request.
+func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, string, error) {
 	var files []RequestFile
+	message := r.Header.Get(ezhttp.HeaderMessage)
 	contentType := r.Header.Get(ezhttp.HeaderContentType)
 	if contentType != "" {
 		var err error
 		contentType, _, err = mime.ParseMediaType(contentType)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse content type: %w", err)
+			return nil, "", fmt.Errorf("failed to parse content type: %w", err)
 		}
 	}
 	query := r.URL.Query()
 
 	expiresAt, err := getExpiresAt(query, r.Header)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	if contentType == "multipart/form-data" {
 		mr, err := r.MultipartReader()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get multipart reader: %w", err)
+			return nil, "", fmt.Errorf("failed to get multipart reader: %w", err)
 		}
 
 		var limitReader *gio.LimitedReader
@@ -906,15 +1515,25 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 				if errors.Is(err, io.EOF) {
 					break
 				}
-				return nil, fmt.Errorf("failed to get multipart part: %w", err)
+				return nil, "", fmt.Errorf("failed to get multipart part: %w", err)
+			}
+
+			if part.FormName() == "message" && part.FileName() == "" {
+				data, err := io.ReadAll(io.LimitReader(part, maxMessageLength+1))
+				if err != nil {
+					return nil, "", fmt.Errorf("failed to read message part: %w", err)
+				}
+				message = string(data)
+				i--
+				continue
 			}
 
 			if part.FormName() != fmt.Sprintf("file-%d", i) {
-				return nil, httperr.BadRequest(ErrInvalidMultipartPartName)
+				return nil, "", httperr.BadRequest(ErrInvalidMultipartPartName)
 			}
 
 			if part.FileName() == "" {
-				return nil, httperr.BadRequest(ErrInvalidDocumentFileName)
+				return nil, "", httperr.BadRequest(ErrInvalidDocumentFileName)
 			}
 
 			reader := io.Reader(part)
@@ -925,13 +1544,13 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 			data, err := io.ReadAll(reader)
 			if err != nil {
 				if errors.Is(err, gio.ErrLimitReached) {
-					return nil, httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
+					return nil, "", httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
 				}
-				return nil, fmt.Errorf("failed to read part body: %w", err)
+				return nil, "", fmt.Errorf("failed to read part body: %w", err)
 			}
 
 			if len(data) == 0 {
-				return nil, httperr.BadRequest(ErrInvalidDocumentFileContent)
+				return nil, "", httperr.BadRequest(ErrInvalidDocumentFileContent)
 			}
 
 			partContentType := part.Header.Get(ezhttp.HeaderContentType)
@@ -941,7 +1560,7 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 
 			newExpiresAt, err := getExpiresAt(nil, http.Header(part.Header))
 			if err != nil {
-				return nil, err
+				return nil, "", err
 			}
 			if newExpiresAt != nil {
 				expiresAt = newExpiresAt
@@ -963,44 +1582,52 @@ func (s *Server) parseDocumentFiles(r *http.Request) ([]RequestFile, error) {
 		data, err := io.ReadAll(reader)
 		if err != nil {
 			if errors.Is(err, gio.ErrLimitReached) {
-				return nil, httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
+				return nil, "", httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
 			}
-			return nil, fmt.Errorf("failed to read request body: %w", err)
+			return nil, "", fmt.Errorf("failed to read request body: %w", err)
 		}
 
 		params := make(map[string]string)
 		if contentDisposition := r.Header.Get(ezhttp.HeaderContentDisposition); contentDisposition != "" {
 			_, params, err = mime.ParseMediaType(contentDisposition)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse content disposition: %w", err)
+				return nil, "", fmt.Errorf("failed to parse content disposition: %w", err)
 			}
 		}
 
 		name := params["filename"]
 		if name == "" {
-			name = "untitled"
+			name = chi.URLParam(r, "fileName")
 		}
 
 		language := query.Get("language")
 		if language == "" {
 			language = r.Header.Get(ezhttp.HeaderLanguage)
 		}
+		language = getLanguage(language, contentType, name, string(data))
+
+		if name == "" {
+			name = "untitled"
+		}
 
 		files = []RequestFile{{
 			Name:      name,
 			Content:   string(data),
-			Language:  getLanguage(language, contentType, params["filename"], string(data)),
+			Language:  language,
 			ExpiresAt: expiresAt,
 		}}
 	}
 	for i, file := range files {
 		for ii, f := range files {
 			if strings.EqualFold(file.Name, f.Name) && i != ii {
-				return nil, httperr.BadRequest(ErrDuplicateDocumentFileNames)
+				return nil, "", httperr.BadRequest(ErrDuplicateDocumentFileNames)
 			}
 		}
 	}
-	return files, nil
+	if len(message) > maxMessageLength {
+		return nil, "", httperr.BadRequest(ErrMessageTooLong)
+	}
+	return files, message, nil
 }
 
 func getLanguage(language string, contentType string, fileName string, content string) string {
@@ -1043,6 +1670,48 @@ func getLanguage(language string, contentType string, fileName string, content s
 	return "plaintext"
 }
 
+// getBaseVersion returns the version an update is based on from the If-Match header or the base_version query param.
+// It returns 0 if neither is set or If-Match is *.
+func getBaseVersion(r *http.Request) (int64, error) {
+	baseVersionStr := r.URL.Query().Get("base_version")
+	if ifMatch := r.Header.Get(ezhttp.HeaderIfMatch); ifMatch != "" {
+		baseVersionStr, _, _ = strings.Cut(ifMatch, ",")
+		baseVersionStr = strings.TrimPrefix(strings.TrimSpace(baseVersionStr), "W/")
+		if baseVersionStr == "*" {
+			return 0, nil
+		}
+		baseVersionStr = strings.Trim(baseVersionStr, `"`)
+	}
+	if baseVersionStr == "" {
+		return 0, nil
+	}
+
+	baseVersion, err := strconv.ParseInt(baseVersionStr, 10, 64)
+	if err != nil {
+		return 0, httperr.BadRequest(ErrInvalidBaseVersion)
+	}
+	return baseVersion, nil
+}
+
+// versionLabel returns the label of a version shown in version selects, it contains the humanized time, the tags and the first line of the message.
+func versionLabel(versionTime time.Time, suffix string, message string, tags []string) string {
+	label := humanize.Time(versionTime) + suffix
+	if len(tags) > 0 {
+		label += " [" + strings.Join(tags, ", ") + "]"
+	}
+	if message, _, _ = strings.Cut(message, "\n"); message != "" {
+		if runes := []rune(message); len(runes) > maxVersionLabelMessageLength {
+			message = string(runes[:maxVersionLabelMessageLength]) + "…"
+		}
+		label += ": " + message
+	}
+	return label
+}
+
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
 func getExpiresAt(query url.Values, header http.Header) (*time.Time, error) {
 	expiresAtStr := query.Get("expires")
 	if expiresAtStr == "" {
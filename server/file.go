@@ -0,0 +1,216 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrSingleDocumentFileRequired = errors.New("exactly one document file is required")
+	ErrLastDocumentFile           = errors.New("cannot delete the last document file")
+)
+
+type RenameFileRequest struct {
+	Name string `json:"name"`
+}
+
+// PutDocumentFile adds a new file to a document or replaces an existing one.
+func (s *Server) PutDocumentFile(w http.ResponseWriter, r *http.Request) {
+	files, message, err := s.parseDocumentFiles(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if len(files) != 1 {
+		s.error(w, r, httperr.BadRequest(ErrSingleDocumentFileRequired))
+		return
+	}
+
+	documentID := chi.URLParam(r, "documentID")
+	fileName := chi.URLParam(r, "fileName")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	baseVersion, err := getBaseVersion(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	dbFiles, err := s.getLatestDocumentFiles(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if baseVersion != 0 && dbFiles[0].DocumentVersion != baseVersion {
+		s.conflict(w, r, documentID, dbFiles, nil)
+		return
+	}
+
+	file := database.File{
+		Name:      fileName,
+		Content:   files[0].Content,
+		Language:  files[0].Language,
+		ExpiresAt: files[0].ExpiresAt,
+	}
+	if i := indexFile(dbFiles, fileName); i != -1 {
+		file.Name = dbFiles[i].Name
+		dbFiles[i] = file
+	} else {
+		dbFiles = append(dbFiles, file)
+	}
+	if err = s.checkDocumentSize(dbFiles); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.updateDocument(w, r, documentID, orderFiles(dbFiles), message, baseVersion)
+}
+
+// PatchDocumentFile renames a file of a document.
+func (s *Server) PatchDocumentFile(w http.ResponseWriter, r *http.Request) {
+	var renameRequest RenameFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&renameRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if renameRequest.Name == "" {
+		s.error(w, r, httperr.BadRequest(ErrInvalidDocumentFileName))
+		return
+	}
+
+	documentID := chi.URLParam(r, "documentID")
+	fileName := chi.URLParam(r, "fileName")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	baseVersion, err := getBaseVersion(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	dbFiles, err := s.getLatestDocumentFiles(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if baseVersion != 0 && dbFiles[0].DocumentVersion != baseVersion {
+		s.conflict(w, r, documentID, dbFiles, nil)
+		return
+	}
+
+	i := indexFile(dbFiles, fileName)
+	if i == -1 {
+		s.error(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+		return
+	}
+	if ii := indexFile(dbFiles, renameRequest.Name); ii != -1 && ii != i {
+		s.error(w, r, httperr.Conflict(ErrDuplicateDocumentFileNames))
+		return
+	}
+	dbFiles[i].Name = renameRequest.Name
+
+	s.updateDocument(w, r, documentID, orderFiles(dbFiles), r.Header.Get(ezhttp.HeaderMessage), baseVersion)
+}
+
+// DeleteDocumentFile removes a file from a document.
+func (s *Server) DeleteDocumentFile(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	fileName := chi.URLParam(r, "fileName")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	baseVersion, err := getBaseVersion(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	dbFiles, err := s.getLatestDocumentFiles(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if baseVersion != 0 && dbFiles[0].DocumentVersion != baseVersion {
+		s.conflict(w, r, documentID, dbFiles, nil)
+		return
+	}
+
+	i := indexFile(dbFiles, fileName)
+	if i == -1 {
+		s.error(w, r, httperr.NotFound(ErrDocumentFileNotFound))
+		return
+	}
+	if len(dbFiles) == 1 {
+		s.error(w, r, httperr.BadRequest(ErrLastDocumentFile))
+		return
+	}
+	dbFiles = slices.Delete(dbFiles, i, i+1)
+
+	s.updateDocument(w, r, documentID, orderFiles(dbFiles), r.Header.Get(ezhttp.HeaderMessage), baseVersion)
+}
+
+func (s *Server) getLatestDocumentFiles(r *http.Request, documentID string) ([]database.File, error) {
+	files, err := s.db.GetDocument(r.Context(), documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrDocumentNotFound)
+		}
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+	return files, nil
+}
+
+// checkDocumentSize returns ErrDocumentTooLarge if the contents of all files together are not less than the max document size like in parseDocumentFiles.
+// Requests are only limited per body, so documents built from several requests have to be checked as a whole.
+func (s *Server) checkDocumentSize(files []database.File) error {
+	if s.cfg.MaxDocumentSize <= 0 {
+		return nil
+	}
+	var size int64
+	for _, file := range files {
+		size += int64(len(file.Content))
+	}
+	if size >= s.cfg.MaxDocumentSize {
+		return httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize))
+	}
+	return nil
+}
+
+func indexFile(files []database.File, name string) int {
+	return slices.IndexFunc(files, func(file database.File) bool {
+		return strings.EqualFold(file.Name, name)
+	})
+}
+
+func orderFiles(files []database.File) []database.File {
+	for i := range files {
+		files[i].OrderIndex = i
+	}
+	return files
+}
@@ -2,12 +2,16 @@ package server
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/go-jose/go-jose/v3/jwt"
 
 	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/server/database"
 )
 
 type Permissions int
@@ -17,18 +21,21 @@ const (
 	PermissionDelete
 	PermissionShare
 	PermissionWebhook
+	PermissionRead
 )
 
 var AllPermissions = PermissionWrite |
 	PermissionDelete |
 	PermissionShare |
-	PermissionWebhook
+	PermissionWebhook |
+	PermissionRead
 
-var AllStringPermissions = []string{"write", "delete", "share", "webhook"}
+var AllStringPermissions = []string{"write", "delete", "share", "webhook", "read"}
 
 type Claims struct {
 	jwt.Claims
 	Permissions Permissions `json:"pms"`
+	Scope       *Scope      `json:"scp,omitempty"`
 }
 
 type claimsKey struct{}
@@ -43,8 +50,46 @@ func SetClaims(r *http.Request, claims Claims) *http.Request {
 	return r.WithContext(context.WithValue(r.Context(), claimsContextKey, claims))
 }
 
-func (s *Server) NewToken(documentID string, permissions Permissions) (string, error) {
+// NewToken creates a token for a document and records it, so it can be listed and revoked.
+// issuerID is the ID of the token which shared the new token, empty for the token created with the document.
+// A nil expiresAt creates a token which never expires and a nil scope a token for the whole document.
+func (s *Server) NewToken(ctx context.Context, documentID string, permissions Permissions, issuerID string, expiresAt *time.Time, scope *Scope) (string, error) {
 	claims := newClaims(documentID, permissions)
+	claims.ID = rand.Text()
+	claims.Scope = scope
+	if expiresAt != nil {
+		claims.Expiry = jwt.NewNumericDate(*expiresAt)
+	}
+
+	var issuer *string
+	if issuerID != "" {
+		issuer = &issuerID
+	}
+	token := database.DocumentToken{
+		ID:          claims.ID,
+		DocumentID:  documentID,
+		Permissions: int(permissions),
+		IssuerID:    issuer,
+		CreatedAt:   claims.IssuedAt.Time(),
+		ExpiresAt:   expiresAt,
+	}
+	if scope != nil {
+		if scope.Version != 0 {
+			token.ScopeVersion = &scope.Version
+		}
+		if len(scope.Files) > 0 {
+			files, err := json.Marshal(scope.Files)
+			if err != nil {
+				return "", fmt.Errorf("failed to encode scope files: %w", err)
+			}
+			scopeFiles := string(files)
+			token.ScopeFiles = &scopeFiles
+		}
+	}
+	if err := s.db.CreateDocumentToken(ctx, token); err != nil {
+		return "", err
+	}
+
 	return jwt.Signed(s.signer).Claims(claims).CompactSerialize()
 }
 
@@ -62,6 +107,28 @@ func EmptyClaims(documentID string) Claims {
 	return newClaims(documentID, 0)
 }
 
+// canRead reports whether the claims allow reading a private document.
+func canRead(claims Claims, documentID string) bool {
+	return claims.Subject == documentID && hasRead(claims.Permissions)
+}
+
+// hasRead reports whether the permissions include reading.
+// The write permission includes reading, so tokens created before the read permission existed keep working.
+func hasRead(permissions Permissions) bool {
+	return flags.Has(permissions, PermissionRead) || flags.Has(permissions, PermissionWrite)
+}
+
+// permissionStrings returns the names of the permissions.
+func permissionStrings(permissions Permissions) []string {
+	names := make([]string, 0, len(AllStringPermissions))
+	for i, name := range AllStringPermissions {
+		if flags.Has(permissions, Permissions(1<<i)) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func parsePermissions(perms Permissions, stringPerms []string) (Permissions, error) {
 	var permissions Permissions
 	for _, perm := range stringPerms {
@@ -86,6 +153,11 @@ func parsePermissions(perms Permissions, stringPerms []string) (Permissions, err
 				return 0, ErrPermissionDenied(perm)
 			}
 			permissions = flags.Add(permissions, PermissionWebhook)
+		case "read":
+			if !hasRead(perms) {
+				return 0, ErrPermissionDenied(perm)
+			}
+			permissions = flags.Add(permissions, PermissionRead)
 		}
 	}
 	return permissions, nil
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrMergeConflict = errors.New("document has been updated since the base version and the changes conflict")
+
+const (
+	MergeConflictReasonContent = "content"
+	MergeConflictReasonDeleted = "deleted"
+)
+
+type (
+	MergeConflictFile struct {
+		Name      string          `json:"name"`
+		Reason    string          `json:"reason"`
+		Conflicts []MergeConflict `json:"conflicts,omitempty"`
+	}
+
+	MergeConflict struct {
+		Line     int    `json:"line"`
+		Base     string `json:"base"`
+		Current  string `json:"current"`
+		Incoming string `json:"incoming"`
+	}
+)
+
+// mergeFiles merges the changes from the base to the incoming files into the current files.
+// Files are matched by name, a file which was changed on one side and deleted on the other side is a conflict.
+// The merged files keep the order of the incoming files followed by files which were only added in the current version.
+func mergeFiles(base []database.File, current []database.File, incoming []database.File) ([]database.File, []MergeConflictFile) {
+	var (
+		merged    []database.File
+		conflicts []MergeConflictFile
+	)
+	for _, file := range incoming {
+		baseFile := findFile(base, file.Name)
+		currentFile := findFile(current, file.Name)
+
+		if currentFile == nil {
+			switch {
+			case baseFile == nil:
+				// added in the incoming version
+				merged = append(merged, file)
+			case baseFile.Content != file.Content:
+				conflicts = append(conflicts, MergeConflictFile{
+					Name:   file.Name,
+					Reason: MergeConflictReasonDeleted,
+				})
+			}
+			// otherwise deleted in the current version and unchanged in the incoming version
+			continue
+		}
+
+		var baseContent string
+		if baseFile != nil {
+			baseContent = baseFile.Content
+			if file.Language == baseFile.Language {
+				file.Language = currentFile.Language
+			}
+		}
+
+		content, fileConflicts := diff.Merge(baseContent, currentFile.Content, file.Content)
+		if len(fileConflicts) > 0 {
+			mergeConflicts := make([]MergeConflict, len(fileConflicts))
+			for i, conflict := range fileConflicts {
+				mergeConflicts[i] = MergeConflict{
+					Line:     conflict.BaseLine,
+					Base:     conflict.Base,
+					Current:  conflict.Ours,
+					Incoming: conflict.Theirs,
+				}
+			}
+			conflicts = append(conflicts, MergeConflictFile{
+				Name:      file.Name,
+				Reason:    MergeConflictReasonContent,
+				Conflicts: mergeConflicts,
+			})
+			continue
+		}
+		file.Content = content
+		merged = append(merged, file)
+	}
+
+	for _, file := range current {
+		if findFile(incoming, file.Name) != nil {
+			continue
+		}
+
+		baseFile := findFile(base, file.Name)
+		switch {
+		case baseFile == nil:
+			// added in the current version
+			merged = append(merged, file)
+		case baseFile.Content != file.Content:
+			conflicts = append(conflicts, MergeConflictFile{
+				Name:   file.Name,
+				Reason: MergeConflictReasonDeleted,
+			})
+		}
+		// otherwise deleted in the incoming version and unchanged in the current version
+	}
+
+	return orderFiles(merged), conflicts
+}
+
+func findFile(files []database.File, name string) *database.File {
+	if i := indexFile(files, name); i != -1 {
+		return &files[i]
+	}
+	return nil
+}
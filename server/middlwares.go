@@ -1,6 +1,9 @@
 package server
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -27,10 +30,39 @@ var (
 	ErrPermissionDenied = func(p string) error {
 		return fmt.Errorf("permission denied: %s", p)
 	}
+	ErrTokenRevoked = errors.New("token has been revoked")
+	ErrTokenExpired = errors.New("token has expired")
 )
 
 func (s *Server) cacheKeyFunc(r *http.Request) (uint64, error) {
-	return stampede.BytesToHash([]byte(r.Method), []byte(chi.URLParam(r, "documentID")), []byte(chi.URLParam(r, "version")), []byte(r.URL.RawQuery)), nil
+	// tokens scoped to a version or files see a different document
+	var scope []byte
+	if claimsScope := GetClaims(r).Scope; claimsScope != nil {
+		var err error
+		if scope, err = json.Marshal(claimsScope); err != nil {
+			return 0, err
+		}
+	}
+	return stampede.BytesToHash([]byte(r.Method), []byte(chi.URLParam(r, "documentID")), []byte(chi.URLParam(r, "version")), []byte(r.URL.RawQuery), scope), nil
+}
+
+type peerAddrKey struct{}
+
+var peerAddrContextKey = peerAddrKey{}
+
+// peerAddr keeps the address of the connection, as middleware.RealIP replaces r.RemoteAddr with the client supplied headers.
+func peerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), peerAddrContextKey, r.RemoteAddr)))
+	})
+}
+
+// getPeerAddr returns the address of the connection of the request, not the one of X-Forwarded-For or X-Real-IP.
+func getPeerAddr(r *http.Request) string {
+	if addr, ok := r.Context().Value(peerAddrContextKey).(string); ok {
+		return addr
+	}
+	return r.RemoteAddr
 }
 
 func cacheControl(next http.Handler) http.Handler {
@@ -47,8 +79,8 @@ func cacheControl(next http.Handler) http.Handler {
 
 func (s *Server) RateLimit(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Only apply rate limiting to POST, PATCH, and DELETE requests
-		if r.Method != http.MethodPost && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
+		// Only apply rate limiting to POST, PUT, PATCH, and DELETE requests
+		if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch && r.Method != http.MethodDelete {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -88,18 +120,128 @@ func (s *Server) JWTMiddleware(next http.Handler) http.Handler {
 			documentID := chi.URLParam(r, "documentID")
 			claims = EmptyClaims(documentID)
 		} else {
-			token, err := jwt.ParseSigned(tokenString)
-			if err != nil {
-				s.error(w, r, httperr.Unauthorized(err))
+			var err error
+			if claims, err = s.parseToken(r.Context(), tokenString); err != nil {
+				s.error(w, r, err)
 				return
 			}
+		}
+
+		next.ServeHTTP(w, SetClaims(r, claims))
+	})
+}
+
+// parseToken verifies a token and returns its claims. Expired and revoked tokens are rejected.
+func (s *Server) parseToken(ctx context.Context, tokenString string) (Claims, error) {
+	token, err := jwt.ParseSigned(tokenString)
+	if err != nil {
+		return Claims{}, httperr.Unauthorized(err)
+	}
+
+	var claims Claims
+	if err = token.Claims([]byte(s.cfg.JWTSecret), &claims); err != nil {
+		return Claims{}, httperr.Unauthorized(err)
+	}
 
-			if err = token.Claims([]byte(s.cfg.JWTSecret), &claims); err != nil {
-				s.error(w, r, httperr.Unauthorized(err))
+	if err = claims.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, 0); err != nil {
+		if errors.Is(err, jwt.ErrExpired) {
+			err = ErrTokenExpired
+		}
+		return Claims{}, httperr.Unauthorized(err)
+	}
+
+	// tokens without an ID were created before tokens were recorded and can't be revoked
+	if claims.ID != "" {
+		documentToken, err := s.db.GetDocumentToken(ctx, claims.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Claims{}, fmt.Errorf("failed to get token: %w", err)
+		}
+		if documentToken == nil || documentToken.RevokedAt != nil || documentToken.DocumentID != claims.Subject {
+			return Claims{}, httperr.Unauthorized(ErrTokenRevoked)
+		}
+	}
+
+	return claims, nil
+}
+
+// ReadPermission hides private and password protected documents from requests which are not allowed to read them.
+// Browsers can't send the Authorization header when navigating, so reading requests can also pass a token
+// with the token query parameter or the token_{documentID} cookie. Such a token only grants reading the document.
+// Errors are written with onError, so pages can render them.
+func (s *Server) ReadPermission(onError func(w http.ResponseWriter, r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
 				return
 			}
+
+			documentID := chi.URLParam(r, "documentID")
+			claims := GetClaims(r)
+			if claims.Subject == "" {
+				claims = EmptyClaims(documentID)
+				if tokenString := requestReadToken(r, documentID); tokenString != "" {
+					tokenClaims, err := s.parseToken(r.Context(), tokenString)
+					var httpErr *httperr.Error
+					if err != nil && !errors.As(err, &httpErr) {
+						onError(w, r, err)
+						return
+					}
+					// an invalid token is ignored, it isn't needed for public documents
+					if err == nil && canRead(tokenClaims, documentID) {
+						claims.Permissions = PermissionRead
+						claims.Scope = tokenClaims.Scope
+					}
+				}
+				r = SetClaims(r, claims)
+			}
+
+			if err := s.checkRead(w, r, documentID); err != nil {
+				onError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestReadToken(r *http.Request, documentID string) string {
+	if tokenString := r.URL.Query().Get("token"); tokenString != "" {
+		return tokenString
+	}
+	if cookie, err := r.Cookie("token_" + documentID); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// checkRead returns an error if the document is private or password protected and the request is not allowed to read it.
+// Private documents are reported as not found, so their existence isn't revealed.
+// Password protected documents can be unlocked with the unlock cookie or the Password header.
+func (s *Server) checkRead(w http.ResponseWriter, r *http.Request, documentID string) error {
+	access, err := s.db.GetDocumentAccess(r.Context(), documentID)
+	if err != nil {
+		// missing documents are reported by the handlers
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
 		}
+		return err
+	}
+	if canRead(GetClaims(r), documentID) {
+		return nil
+	}
 
-		next.ServeHTTP(w, SetClaims(r, claims))
-	})
+	if access.PasswordHash != nil {
+		if s.hasUnlockCookie(r, documentID, *access.PasswordHash) {
+			return nil
+		}
+		if password := r.Header.Get(ezhttp.HeaderPassword); password != "" {
+			return s.checkPassword(w, r, documentID, *access.PasswordHash, password)
+		}
+		return httperr.Unauthorized(ErrDocumentLocked)
+	}
+	if Visibility(access.Visibility) == VisibilityPrivate {
+		return httperr.NotFound(ErrDocumentNotFound)
+	}
+	return nil
 }
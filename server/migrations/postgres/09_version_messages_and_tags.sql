@@ -0,0 +1,12 @@
+--- v3.1.0
+
+ALTER TABLE files
+    ADD COLUMN message VARCHAR NOT NULL DEFAULT '';
+
+CREATE TABLE document_tags
+(
+    document_id      VARCHAR NOT NULL,
+    name             VARCHAR NOT NULL,
+    document_version BIGINT  NOT NULL,
+    PRIMARY KEY (document_id, name)
+);
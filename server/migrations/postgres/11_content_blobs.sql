@@ -0,0 +1,28 @@
+--- v3.1.0
+
+CREATE TABLE blobs
+(
+    hash      VARCHAR PRIMARY KEY,
+    content   TEXT    NOT NULL,
+    size      BIGINT  NOT NULL,
+    lines     BIGINT  NOT NULL,
+    ref_count BIGINT  NOT NULL
+);
+
+INSERT INTO blobs (hash, content, size, lines, ref_count)
+SELECT hash,
+       content,
+       octet_length(content),
+       length(content) - length(replace(content, chr(10), '')) + CASE WHEN content = '' OR content LIKE '%' || chr(10) THEN 0 ELSE 1 END,
+       COUNT(*)
+FROM (SELECT encode(sha256(convert_to(content, 'UTF8')), 'hex') AS hash, content FROM files) AS f
+GROUP BY hash, content;
+
+ALTER TABLE files
+    ADD COLUMN content_hash VARCHAR NOT NULL DEFAULT '';
+
+UPDATE files
+SET content_hash = encode(sha256(convert_to(content, 'UTF8')), 'hex');
+
+ALTER TABLE files
+    DROP COLUMN content;
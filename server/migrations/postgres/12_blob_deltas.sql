@@ -0,0 +1,7 @@
+--- v3.1.0
+
+ALTER TABLE blobs
+    ADD COLUMN base_hash VARCHAR NOT NULL DEFAULT '';
+
+ALTER TABLE blobs
+    ADD COLUMN depth BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+--- v3.1.0
+
+ALTER TABLE blobs
+    ALTER COLUMN content TYPE BYTEA USING convert_to(content, 'UTF8');
+
+-- existing content is not compressed yet, it is re-compressed in the background with the configured compression
+ALTER TABLE blobs
+    ADD COLUMN compression VARCHAR NOT NULL DEFAULT 'none';
@@ -0,0 +1,4 @@
+--- v3.1.0
+
+ALTER TABLE blobs
+    ADD COLUMN external BOOLEAN NOT NULL DEFAULT FALSE;
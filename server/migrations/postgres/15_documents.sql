@@ -0,0 +1,38 @@
+--- v3.1.0
+
+CREATE TABLE documents
+(
+    id           VARCHAR PRIMARY KEY,
+    head_version BIGINT    NOT NULL,
+    created_at   TIMESTAMP NOT NULL,
+    -- the earliest expiry of any file of the document
+    expires_at   TIMESTAMP
+);
+
+CREATE TABLE document_versions
+(
+    document_id VARCHAR NOT NULL,
+    version     BIGINT  NOT NULL,
+    message     VARCHAR NOT NULL DEFAULT '',
+    -- the earliest expiry of any file of the version
+    expires_at  TIMESTAMP,
+    PRIMARY KEY (document_id, version)
+);
+
+CREATE INDEX document_versions_version_idx ON document_versions (version);
+CREATE INDEX document_versions_expires_at_idx ON document_versions (expires_at);
+
+INSERT INTO document_versions (document_id, version, message, expires_at)
+SELECT document_id, document_version, MAX(message), MIN(expires_at)
+FROM files
+GROUP BY document_id, document_version;
+
+INSERT INTO documents (id, head_version, created_at, expires_at)
+SELECT document_id, MAX(version), to_timestamp(MIN(version) / 1000.0) AT TIME ZONE 'UTC', MIN(expires_at)
+FROM document_versions
+GROUP BY document_id;
+
+ALTER TABLE files
+    DROP COLUMN message;
+
+CREATE INDEX files_document_version_idx ON files (document_id, document_version);
@@ -0,0 +1,15 @@
+--- v3.1.0
+
+CREATE TABLE document_tokens
+(
+    id          VARCHAR PRIMARY KEY,
+    document_id VARCHAR   NOT NULL,
+    permissions INTEGER   NOT NULL,
+    -- the token which shared this token, NULL for the token created with the document
+    issuer_id   VARCHAR,
+    created_at  TIMESTAMP NOT NULL,
+    revoked_at  TIMESTAMP
+);
+
+CREATE INDEX document_tokens_document_id_idx ON document_tokens (document_id);
+CREATE INDEX document_tokens_issuer_id_idx ON document_tokens (issuer_id);
@@ -0,0 +1,5 @@
+--- v3.1.0
+
+-- public or private, private documents can only be read with a token with the read permission
+ALTER TABLE documents
+    ADD COLUMN visibility VARCHAR NOT NULL DEFAULT 'public';
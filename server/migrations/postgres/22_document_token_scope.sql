@@ -0,0 +1,7 @@
+--- v3.1.0
+
+-- the version and the JSON array of file names the token is restricted to, NULL if the token is not restricted
+ALTER TABLE document_tokens
+    ADD COLUMN scope_version BIGINT;
+ALTER TABLE document_tokens
+    ADD COLUMN scope_files VARCHAR;
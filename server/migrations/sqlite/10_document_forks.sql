@@ -0,0 +1,8 @@
+--- v3.1.0
+
+CREATE TABLE document_forks
+(
+    document_id             VARCHAR NOT NULL PRIMARY KEY,
+    parent_document_id      VARCHAR NOT NULL,
+    parent_document_version BIGINT  NOT NULL
+);
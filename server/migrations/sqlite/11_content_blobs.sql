@@ -0,0 +1,29 @@
+--- v3.1.0
+
+CREATE TABLE blobs
+(
+    hash      VARCHAR PRIMARY KEY,
+    content   TEXT    NOT NULL,
+    size      BIGINT  NOT NULL,
+    lines     BIGINT  NOT NULL,
+    ref_count BIGINT  NOT NULL
+);
+
+-- sha256_hex is registered by gobin as sqlite has no built-in sha256 function
+INSERT INTO blobs (hash, content, size, lines, ref_count)
+SELECT hash,
+       content,
+       octet_length(content),
+       length(content) - length(replace(content, char(10), '')) + CASE WHEN content = '' OR content LIKE '%' || char(10) THEN 0 ELSE 1 END,
+       COUNT(*)
+FROM (SELECT sha256_hex(content) AS hash, content FROM files) AS f
+GROUP BY hash, content;
+
+ALTER TABLE files
+    ADD COLUMN content_hash VARCHAR NOT NULL DEFAULT '';
+
+UPDATE files
+SET content_hash = sha256_hex(content);
+
+ALTER TABLE files
+    DROP COLUMN content;
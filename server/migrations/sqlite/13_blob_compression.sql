@@ -0,0 +1,24 @@
+--- v3.1.0
+
+-- compressed content is binary, sqlite can't change the type of a column so the table is recreated
+-- existing content is not compressed yet, it is re-compressed in the background with the configured compression
+CREATE TABLE blobs_new
+(
+    hash        VARCHAR PRIMARY KEY,
+    content     BLOB    NOT NULL,
+    compression VARCHAR NOT NULL DEFAULT 'none',
+    base_hash   VARCHAR NOT NULL DEFAULT '',
+    depth       BIGINT  NOT NULL DEFAULT 0,
+    size        BIGINT  NOT NULL,
+    lines       BIGINT  NOT NULL,
+    ref_count   BIGINT  NOT NULL
+);
+
+INSERT INTO blobs_new (hash, content, compression, base_hash, depth, size, lines, ref_count)
+SELECT hash, CAST(content AS BLOB), 'none', base_hash, depth, size, lines, ref_count
+FROM blobs;
+
+DROP TABLE blobs;
+
+ALTER TABLE blobs_new
+    RENAME TO blobs;
@@ -0,0 +1,9 @@
+--- v3.1.0
+
+-- overrides of the instance version retention, NULL uses the instance default and 0 disables the limit
+ALTER TABLE documents
+    ADD COLUMN keep_versions INTEGER;
+
+-- in milliseconds
+ALTER TABLE documents
+    ADD COLUMN keep_versions_for BIGINT;
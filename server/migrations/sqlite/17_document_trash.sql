@@ -0,0 +1,7 @@
+--- v3.1.0
+
+-- documents with a deleted_at are in the trash, they are hidden and purged after the grace period
+ALTER TABLE documents
+    ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX documents_deleted_at_idx ON documents (deleted_at);
@@ -0,0 +1,5 @@
+--- v3.1.0
+
+-- NULL if the token never expires
+ALTER TABLE document_tokens
+    ADD COLUMN expires_at TIMESTAMP;
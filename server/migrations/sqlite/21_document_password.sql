@@ -0,0 +1,5 @@
+--- v3.1.0
+
+-- argon2id hash of the password which unlocks the document, NULL if the document has no password
+ALTER TABLE documents
+    ADD COLUMN password_hash VARCHAR;
@@ -0,0 +1,332 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/internal/httprate"
+	"github.com/topi314/gobin/v3/server/templates"
+)
+
+const (
+	maxPasswordLength = 1024
+
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	unlockCookiePrefix = "unlock_"
+)
+
+var (
+	ErrDocumentLocked      = errors.New("document is password protected")
+	ErrInvalidPassword     = errors.New("invalid password")
+	ErrPasswordTooLong     = fmt.Errorf("password too long, must be at most %d characters", maxPasswordLength)
+	ErrEmptyPassword       = errors.New("password must not be empty")
+	ErrInvalidPasswordHash = errors.New("invalid password hash")
+)
+
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// hashPassword hashes a password with argon2id and encodes it in the PHC string format.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		argon2Memory,
+		argon2Time,
+		argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
+}
+
+// verifyPassword reports whether the password matches the hash created by hashPassword.
+func verifyPassword(passwordHash string, password string) (bool, error) {
+	parts := strings.Split(passwordHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidPasswordHash
+	}
+
+	var (
+		memory     uint32
+		iterations uint32
+		threads    uint8
+	)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, ErrInvalidPasswordHash
+	}
+
+	otherHash := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(hash, otherHash) == 1, nil
+}
+
+// checkPassword verifies an unlock attempt. The attempt is counted towards the limits per document and per IP and document before the password is verified,
+// so concurrent attempts can't exceed them, and given back if the password is correct.
+func (s *Server) checkPassword(w http.ResponseWriter, r *http.Request, documentID string, passwordHash string, password string) error {
+	if !s.documentUnlockLimiter.Allow(w, documentID) {
+		return httperr.TooManyRequests(ErrRateLimit)
+	}
+	// checked last, so the rate limit headers show the limit of the IP
+	key := s.unlockIPKey(r) + ":" + documentID
+	if !s.unlockLimiter.Allow(w, key) {
+		// the attempt isn't verified, so it doesn't count towards the limit of the document
+		s.documentUnlockLimiter.Refund(documentID)
+		return httperr.TooManyRequests(ErrRateLimit)
+	}
+
+	select {
+	case s.passwordVerifications <- struct{}{}:
+		defer func() {
+			<-s.passwordVerifications
+		}()
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+
+	ok, err := verifyPassword(passwordHash, password)
+	if err != nil {
+		return fmt.Errorf("failed to verify password: %w", err)
+	}
+	if !ok {
+		return httperr.Unauthorized(ErrInvalidPassword)
+	}
+	s.unlockLimiter.Refund(key)
+	s.documentUnlockLimiter.Refund(documentID)
+	return nil
+}
+
+// unlockIPKey returns the IP unlock attempts are limited by.
+// The X-Forwarded-For and X-Real-IP headers are set by the client unless a proxy overwrites them, so they are only used if trusted.
+func (s *Server) unlockIPKey(r *http.Request) string {
+	if s.cfg.Password.TrustProxyHeaders {
+		return httprate.IPKey(r)
+	}
+	return httprate.AddrKey(getPeerAddr(r))
+}
+
+// unlockCookieValue signs the document, the expiry and the password hash, so changing the password invalidates the cookie.
+func (s *Server) unlockCookieValue(documentID string, passwordHash string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
+	_, _ = mac.Write([]byte(documentID + "\n" + expires + "\n" + passwordHash))
+	return expires + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) hasUnlockCookie(r *http.Request, documentID string, passwordHash string) bool {
+	cookie, err := r.Cookie(unlockCookiePrefix + documentID)
+	if err != nil {
+		return false
+	}
+
+	expires, _, _ := strings.Cut(cookie.Value, ".")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return false
+	}
+	expiresAt := time.Unix(unix, 0)
+	if time.Now().After(expiresAt) {
+		return false
+	}
+
+	return hmac.Equal([]byte(cookie.Value), []byte(s.unlockCookieValue(documentID, passwordHash, expiresAt)))
+}
+
+// PostDocumentUnlock checks the password submitted by the unlock form and sets a cookie which unlocks the document for a while.
+func (s *Server) PostDocumentUnlock(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	access, err := s.db.GetDocumentAccess(r.Context(), documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.prettyError(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.prettyError(w, r, err)
+		return
+	}
+
+	redirect := unlockRedirect(documentID, r.PostFormValue("redirect"))
+	if access.PasswordHash == nil {
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	if err = s.checkPassword(w, r, documentID, *access.PasswordHash, r.PostFormValue("password")); err != nil {
+		s.renderUnlock(w, r, documentID, redirect, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.cfg.Password.UnlockDuration))
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookiePrefix + documentID,
+		Value:    s.unlockCookieValue(documentID, *access.PasswordHash, expiresAt),
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(time.Duration(s.cfg.Password.UnlockDuration).Seconds()),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// unlockRedirect only allows redirects to pages of the unlocked document.
+func unlockRedirect(documentID string, redirect string) string {
+	path := "/" + documentID
+	if redirect == path || strings.HasPrefix(redirect, path+"/") || strings.HasPrefix(redirect, path+"?") {
+		return redirect
+	}
+	return path
+}
+
+// renderUnlock renders the unlock form, err is shown on the form unless it is ErrDocumentLocked.
+func (s *Server) renderUnlock(w http.ResponseWriter, r *http.Request, documentID string, redirect string, err error) {
+	status := http.StatusUnauthorized
+	var message string
+	if !errors.Is(err, ErrDocumentLocked) {
+		var httpErr *httperr.Error
+		if !errors.As(err, &httpErr) {
+			s.prettyError(w, r, err)
+			return
+		}
+		status = httpErr.Status
+		message = err.Error()
+	}
+
+	w.Header().Set(ezhttp.HeaderContentType, ezhttp.ContentTypeHTML)
+	w.WriteHeader(status)
+	if tmplErr := templates.Unlock(templates.UnlockVars{
+		ID:       documentID,
+		Redirect: redirect,
+		Error:    message,
+	}).Render(r.Context(), w); tmplErr != nil && !errors.Is(tmplErr, http.ErrHandlerTimeout) {
+		slog.ErrorContext(r.Context(), "failed to execute unlock template", slog.Any("err", tmplErr))
+	}
+}
+
+// prettyReadError renders the unlock form for password protected documents and the error page otherwise.
+func (s *Server) prettyReadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrDocumentLocked) {
+		s.renderUnlock(w, r, chi.URLParam(r, "documentID"), r.URL.RequestURI(), err)
+		return
+	}
+	s.prettyError(w, r, err)
+}
+
+// PutDocumentPassword sets or changes the password of a document.
+func (s *Server) PutDocumentPassword(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var passwordRequest PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&passwordRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	passwordHash, err := getPasswordHash(passwordRequest.Password)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if passwordHash == nil {
+		s.error(w, r, httperr.BadRequest(ErrEmptyPassword))
+		return
+	}
+
+	if err = s.db.SetDocumentPassword(r.Context(), documentID, passwordHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// DeleteDocumentPassword removes the password of a document.
+func (s *Server) DeleteDocumentPassword(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	if err := s.db.SetDocumentPassword(r.Context(), documentID, nil); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// getPasswordHash hashes the password, an empty password returns nil.
+func getPasswordHash(password string) (*string, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if len(password) > maxPasswordLength {
+		return nil, httperr.BadRequest(ErrPasswordTooLong)
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	return &passwordHash, nil
+}
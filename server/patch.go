@@ -0,0 +1,178 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/topi314/gobin/v3/internal/diff"
+	"github.com/topi314/gobin/v3/internal/ezhttp"
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/gio"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrPatchNotApplicable = errors.New("patch does not apply")
+	ErrPatchFileNotFound  = errors.New("file not found")
+	ErrPatchFileExists    = errors.New("file already exists")
+)
+
+type (
+	PatchErrorResponse struct {
+		ezhttp.ErrorResponse
+		Errors []PatchError `json:"errors"`
+	}
+
+	PatchError struct {
+		File    string `json:"file"`
+		Hunk    int    `json:"hunk,omitempty"`
+		Line    int    `json:"line,omitempty"`
+		Message string `json:"message"`
+	}
+)
+
+// PostDocumentPatch applies a unified or git diff to the latest version of a document and stores the result as a new version.
+func (s *Server) PostDocumentPatch(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	message := r.Header.Get(ezhttp.HeaderMessage)
+	if len(message) > maxMessageLength {
+		s.error(w, r, httperr.BadRequest(ErrMessageTooLong))
+		return
+	}
+
+	baseVersion, err := getBaseVersion(r)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	reader := io.Reader(r.Body)
+	if s.cfg.MaxDocumentSize > 0 {
+		reader = gio.LimitReader(r.Body, s.cfg.MaxDocumentSize)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		if errors.Is(err, gio.ErrLimitReached) {
+			s.error(w, r, httperr.BadRequest(ErrDocumentTooLarge(s.cfg.MaxDocumentSize)))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to read request body: %w", err))
+		return
+	}
+
+	patches, err := diff.Parse(string(data))
+	if err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	dbFiles, err := s.getLatestDocumentFiles(r, documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+	if baseVersion != 0 && dbFiles[0].DocumentVersion != baseVersion {
+		s.conflict(w, r, documentID, dbFiles, nil)
+		return
+	}
+
+	version := dbFiles[0].DocumentVersion
+	dbFiles, patchErrs := applyPatches(dbFiles, patches)
+	if len(patchErrs) > 0 {
+		w.Header().Set(ezhttp.HeaderETag, formatETag(version))
+		s.json(w, r, PatchErrorResponse{
+			ErrorResponse: ezhttp.ErrorResponse{
+				Message:   ErrPatchNotApplicable.Error(),
+				Status:    http.StatusConflict,
+				Path:      r.URL.Path,
+				RequestID: middleware.GetReqID(r.Context()),
+			},
+			Errors: patchErrs,
+		}, http.StatusConflict)
+		return
+	}
+	if len(dbFiles) == 0 {
+		s.error(w, r, httperr.BadRequest(ErrLastDocumentFile))
+		return
+	}
+	if err = s.checkDocumentSize(dbFiles); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.updateDocument(w, r, documentID, orderFiles(dbFiles), message, baseVersion)
+}
+
+// applyPatches applies the file patches to the files and returns the patched files.
+// New files are appended, removed files are removed and renamed files keep their position.
+func applyPatches(files []database.File, patches []diff.FilePatch) ([]database.File, []PatchError) {
+	var patchErrs []PatchError
+	for _, patch := range patches {
+		name := patch.OldName
+		if name == "" {
+			name = patch.NewName
+		}
+
+		i := -1
+		if patch.OldName != "" {
+			if i = indexFile(files, patch.OldName); i == -1 {
+				patchErrs = append(patchErrs, PatchError{File: name, Message: ErrPatchFileNotFound.Error()})
+				continue
+			}
+		}
+		if patch.NewName != "" {
+			if ii := indexFile(files, patch.NewName); ii != -1 && ii != i {
+				patchErrs = append(patchErrs, PatchError{File: patch.NewName, Message: ErrPatchFileExists.Error()})
+				continue
+			}
+		}
+
+		var content string
+		if i != -1 {
+			content = files[i].Content
+		}
+		content, errs := diff.Apply(content, patch.Hunks)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				patchErr := PatchError{File: name, Message: err.Error()}
+				var hunkErr *diff.HunkError
+				if errors.As(err, &hunkErr) {
+					patchErr.Hunk = hunkErr.Hunk
+					patchErr.Line = hunkErr.Line
+					patchErr.Message = hunkErr.Err.Error()
+				}
+				patchErrs = append(patchErrs, patchErr)
+			}
+			continue
+		}
+
+		switch {
+		case patch.NewName == "":
+			files = slices.Delete(files, i, i+1)
+		case i == -1:
+			files = append(files, database.File{
+				Name:     patch.NewName,
+				Content:  content,
+				Language: getLanguage("", "", patch.NewName, content),
+			})
+		default:
+			files[i].Name = patch.NewName
+			files[i].Content = content
+		}
+	}
+	return files, patchErrs
+}
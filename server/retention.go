@@ -0,0 +1,126 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrInvalidRetention = errors.New("invalid retention, keep_versions must be 0 or greater and keep_versions_for a duration of 0 or greater")
+
+type (
+	// RetentionRequest overrides the version retention of a document, null uses the instance default and 0 disables the limit.
+	RetentionRequest struct {
+		KeepVersions    *int    `json:"keep_versions"`
+		KeepVersionsFor *string `json:"keep_versions_for"`
+	}
+
+	RetentionResponse struct {
+		KeepVersions           *int    `json:"keep_versions"`
+		KeepVersionsFor        *string `json:"keep_versions_for"`
+		DefaultKeepVersions    int     `json:"default_keep_versions"`
+		DefaultKeepVersionsFor string  `json:"default_keep_versions_for"`
+	}
+)
+
+func (s *Server) GetDocumentRetention(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	retention, err := s.db.GetDocumentRetention(r.Context(), documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, s.newRetentionResponse(*retention))
+}
+
+// PutDocumentRetention replaces the version retention override of a document.
+func (s *Server) PutDocumentRetention(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var retentionRequest RetentionRequest
+	if err := json.NewDecoder(r.Body).Decode(&retentionRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	var retention database.DocumentRetention
+	if retentionRequest.KeepVersions != nil {
+		if *retentionRequest.KeepVersions < 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidRetention))
+			return
+		}
+		retention.KeepVersions = retentionRequest.KeepVersions
+	}
+	if retentionRequest.KeepVersionsFor != nil {
+		keepVersionsFor, err := time.ParseDuration(*retentionRequest.KeepVersionsFor)
+		if err != nil || keepVersionsFor < 0 {
+			s.error(w, r, httperr.BadRequest(ErrInvalidRetention))
+			return
+		}
+		milliseconds := keepVersionsFor.Milliseconds()
+		retention.KeepVersionsFor = &milliseconds
+	}
+
+	s.setDocumentRetention(w, r, documentID, retention)
+}
+
+// DeleteDocumentRetention removes the version retention override of a document, so the instance default is used.
+func (s *Server) DeleteDocumentRetention(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	s.setDocumentRetention(w, r, documentID, database.DocumentRetention{})
+}
+
+func (s *Server) setDocumentRetention(w http.ResponseWriter, r *http.Request, documentID string, retention database.DocumentRetention) {
+	if err := s.db.SetDocumentRetention(r.Context(), documentID, retention); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, s.newRetentionResponse(retention))
+}
+
+func (s *Server) newRetentionResponse(retention database.DocumentRetention) RetentionResponse {
+	var keepVersionsFor *string
+	if retention.KeepVersionsFor != nil {
+		duration := (time.Duration(*retention.KeepVersionsFor) * time.Millisecond).String()
+		keepVersionsFor = &duration
+	}
+
+	return RetentionResponse{
+		KeepVersions:           retention.KeepVersions,
+		KeepVersionsFor:        keepVersionsFor,
+		DefaultKeepVersions:    s.cfg.Database.KeepVersions,
+		DefaultKeepVersionsFor: time.Duration(s.cfg.Database.KeepVersionsFor).String(),
+	}
+}
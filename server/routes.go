@@ -24,6 +24,7 @@ import (
 
 var (
 	ErrDocumentNotFound       = errors.New("document not found")
+	ErrDocumentNotInTrash     = errors.New("document not found in trash")
 	ErrDocumentFileNotFound   = errors.New("document file not found")
 	ErrInvalidDocumentVersion = errors.New("document version is invalid")
 	ErrPreviewsDisabled       = errors.New("document previews disabled")
@@ -38,6 +39,7 @@ func (s *Server) Routes() http.Handler {
 	r.Use(metric.NewRequestInFlight(baseCfg))
 	r.Use(metric.NewResponseSizeBytes(baseCfg))
 	r.Use(middleware.CleanPath)
+	r.Use(peerAddr)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.RequestID)
 	r.Use(slogchi.NewWithConfig(slog.Default(), slogchi.Config{
@@ -104,22 +106,63 @@ func (s *Server) Routes() http.Handler {
 		filesHandler := func(r chi.Router) {
 			r.Route("/files/{fileName}", func(r chi.Router) {
 				r.Get("/", s.GetDocumentFile)
+				r.Put("/", s.PutDocumentFile)
+				r.Patch("/", s.PatchDocumentFile)
+				r.Delete("/", s.DeleteDocumentFile)
 			})
 		}
 		r.Route("/{documentID}", func(r chi.Router) {
+			r.Use(s.ReadPermission(s.error))
 			r.Get("/", s.GetDocument)
 			r.Patch("/", s.PatchDocument)
 			r.Delete("/", s.DeleteDocument)
 			r.Post("/share", s.PostDocumentShare)
+			r.Post("/restore", s.PostDocumentRestore)
+			r.Post("/fork", s.PostDocumentFork)
+			r.Post("/patch", s.PostDocumentPatch)
+			r.Get("/diff", s.GetDocumentDiff)
+			r.Get("/blame", s.GetDocumentBlame)
 
 			r.Route("/versions", func(r chi.Router) {
 				r.Get("/", s.DocumentVersions)
 				r.Route("/{version}", func(r chi.Router) {
 					r.Get("/", s.GetDocument)
 					r.Delete("/", s.DeleteDocument)
+					r.Post("/restore", s.PostDocumentVersionRestore)
+					r.Post("/fork", s.PostDocumentFork)
+					r.Get("/blame", s.GetDocumentBlame)
 				})
 			})
 
+			r.Route("/tags", func(r chi.Router) {
+				r.Get("/", s.GetDocumentTags)
+				r.Route("/{tag}", func(r chi.Router) {
+					r.Put("/", s.PutDocumentTag)
+					r.Delete("/", s.DeleteDocumentTag)
+				})
+			})
+
+			r.Route("/visibility", func(r chi.Router) {
+				r.Get("/", s.GetDocumentVisibility)
+				r.Put("/", s.PutDocumentVisibility)
+			})
+
+			r.Route("/password", func(r chi.Router) {
+				r.Put("/", s.PutDocumentPassword)
+				r.Delete("/", s.DeleteDocumentPassword)
+			})
+
+			r.Route("/retention", func(r chi.Router) {
+				r.Get("/", s.GetDocumentRetention)
+				r.Put("/", s.PutDocumentRetention)
+				r.Delete("/", s.DeleteDocumentRetention)
+			})
+
+			r.Route("/tokens", func(r chi.Router) {
+				r.Get("/", s.GetDocumentTokens)
+				r.Delete("/{tokenID}", s.DeleteDocumentToken)
+			})
+
 			r.Route("/webhooks", func(r chi.Router) {
 				r.Post("/", s.PostDocumentWebhook)
 				r.Route("/{webhookID}", func(r chi.Router) {
@@ -139,6 +182,7 @@ func (s *Server) Routes() http.Handler {
 		})
 	}
 	r.Route("/raw/{documentID}", func(r chi.Router) {
+		r.Use(s.ReadPermission(s.error))
 		r.Get("/", s.GetRawDocument)
 		r.Route("/versions/{version}", func(r chi.Router) {
 			r.Get("/", s.GetRawDocument)
@@ -148,7 +192,9 @@ func (s *Server) Routes() http.Handler {
 	})
 
 	r.Route("/{documentID}", func(r chi.Router) {
+		r.Use(s.ReadPermission(s.prettyReadError))
 		r.Get("/", s.GetPrettyDocument)
+		r.Post("/unlock", s.PostDocumentUnlock)
 		previewHandler(r)
 		r.Route("/{version}", func(r chi.Router) {
 			r.Get("/", s.GetPrettyDocument)
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var (
+	ErrScopedPermissions = errors.New("tokens restricted to a version or files can only have the read permission")
+	ErrTokenScoped       = errors.New("token is restricted to a version or files")
+)
+
+// Scope restricts a token to a version and/or to files of its document.
+// Requests with such a token only see the version and files, the latest version resolves to the scoped version.
+type Scope struct {
+	Version int64    `json:"ver,omitempty"`
+	Files   []string `json:"fls,omitempty"`
+}
+
+// HasFile reports whether the scope allows the file, file names are case-insensitive like in indexFile.
+func (s *Scope) HasFile(name string) bool {
+	return s == nil || len(s.Files) == 0 || slices.ContainsFunc(s.Files, func(scopeFile string) bool {
+		return strings.EqualFold(scopeFile, name)
+	})
+}
+
+// getScope returns the scope of the token of the request if it is a token for the document.
+// A token only restricts reading the document it was created for, other documents are read as without it.
+func getScope(r *http.Request, documentID string) *Scope {
+	claims := GetClaims(r)
+	if claims.Subject != documentID {
+		return nil
+	}
+	return claims.Scope
+}
+
+// scopeVersion returns the version to read for the requested version, 0 is the latest version.
+func scopeVersion(scope *Scope, version int64) (int64, error) {
+	if scope == nil || scope.Version == 0 {
+		return version, nil
+	}
+	if version != 0 && version != scope.Version {
+		return 0, httperr.NotFound(ErrDocumentVersionNotFound)
+	}
+	return scope.Version, nil
+}
+
+// scopeFiles removes the files the scope doesn't allow.
+func scopeFiles(scope *Scope, files []database.File) []database.File {
+	if scope == nil || len(scope.Files) == 0 {
+		return files
+	}
+	return slices.DeleteFunc(files, func(file database.File) bool {
+		return !scope.HasFile(file.Name)
+	})
+}
+
+// checkUnscoped returns an error if the request uses a token for the document restricted to a version or files.
+// Such tokens can't read the history of a document, as it contains other versions and files.
+func checkUnscoped(r *http.Request, documentID string) error {
+	if getScope(r, documentID) != nil {
+		return httperr.Forbidden(ErrTokenScoped)
+	}
+	return nil
+}
+
+// getShareScope returns the scope of a shared token or nil if it is not restricted.
+// Tags are resolved to the version they point to, so moving the tag doesn't change the scope.
+// The files have to exist in the scoped version or the latest version.
+func (s *Server) getShareScope(r *http.Request, documentID string, shareRequest ShareRequest, permissions Permissions) (*Scope, error) {
+	if shareRequest.Version == "" && len(shareRequest.Files) == 0 {
+		return nil, nil
+	}
+	if permissions != PermissionRead {
+		return nil, httperr.BadRequest(ErrScopedPermissions)
+	}
+
+	version, err := s.resolveVersion(r, documentID, shareRequest.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []database.File
+	if version == 0 {
+		files, err = s.db.GetDocument(r.Context(), documentID)
+	} else {
+		files, err = s.db.GetDocumentVersion(r.Context(), documentID, version)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, httperr.NotFound(ErrDocumentVersionNotFound)
+		}
+		return nil, err
+	}
+
+	var scopeFiles []string
+	for _, name := range shareRequest.Files {
+		file := findFile(files, name)
+		if file == nil {
+			return nil, httperr.NotFound(ErrDocumentFileNotFound)
+		}
+		// store the file as it is named in the document, not as it was requested
+		if !slices.Contains(scopeFiles, file.Name) {
+			scopeFiles = append(scopeFiles, file.Name)
+		}
+	}
+
+	return &Scope{
+		Version: version,
+		Files:   scopeFiles,
+	}, nil
+}
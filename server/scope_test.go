@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+func TestShareScopeFileNames(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(ctx, database.Config{
+		Type: database.TypeSQLite,
+		Path: filepath.Join(t.TempDir(), "gobin.db"),
+	}, os.DirFS(".."))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer db.Close()
+
+	documentID, _, err := db.CreateDocument(ctx, []database.File{
+		{Name: "Main.go", Content: "package main", OrderIndex: 0},
+		{Name: "README.md", Content: "# readme", OrderIndex: 1},
+	}, database.DocumentAccess{Visibility: string(VisibilityPublic)}, nil)
+	if err != nil {
+		t.Fatalf("failed to create document: %s", err)
+	}
+
+	s := &Server{db: db}
+	r := httptest.NewRequest(http.MethodPost, "/documents/"+*documentID+"/share", nil)
+	scope, err := s.getShareScope(r, *documentID, ShareRequest{Files: []string{"main.GO", "MAIN.go"}}, PermissionRead)
+	if err != nil {
+		t.Fatalf("failed to get share scope: %s", err)
+	}
+
+	if !slices.Equal(scope.Files, []string{"Main.go"}) {
+		t.Errorf("files = %q, want %q", scope.Files, []string{"Main.go"})
+	}
+	for _, name := range []string{"Main.go", "main.go"} {
+		if !scope.HasFile(name) {
+			t.Errorf("HasFile(%q) = false, want true", name)
+		}
+	}
+	if scope.HasFile("README.md") {
+		t.Errorf("HasFile(%q) = true, want false", "README.md")
+	}
+}
+
+func TestScopeOtherDocument(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.New(ctx, database.Config{
+		Type: database.TypeSQLite,
+		Path: filepath.Join(t.TempDir(), "gobin.db"),
+	}, os.DirFS(".."))
+	if err != nil {
+		t.Fatalf("failed to open database: %s", err)
+	}
+	defer db.Close()
+
+	var documentIDs []string
+	for range 2 {
+		documentID, _, err := db.CreateDocument(ctx, []database.File{
+			{Name: "a.txt", Content: "a", OrderIndex: 0},
+			{Name: "b.txt", Content: "b", OrderIndex: 1},
+		}, database.DocumentAccess{Visibility: string(VisibilityPublic)}, nil)
+		if err != nil {
+			t.Fatalf("failed to create document: %s", err)
+		}
+		documentIDs = append(documentIDs, *documentID)
+	}
+
+	// the token is scoped to a file of the first document
+	claims := newClaims(documentIDs[0], PermissionRead)
+	claims.Scope = &Scope{Files: []string{"a.txt"}}
+
+	s := &Server{db: db}
+	for i, want := range []int{1, 2} {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("documentID", documentIDs[i])
+		r := httptest.NewRequest(http.MethodGet, "/documents/"+documentIDs[i], nil)
+		r = SetClaims(r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)), claims)
+
+		document, err := s.getDocument(r, nil)
+		if err != nil {
+			t.Fatalf("failed to get document %d: %s", i, err)
+		}
+		if len(document.Files) != want {
+			t.Errorf("document %d: files = %d, want %d", i, len(document.Files), want)
+		}
+		if err = checkUnscoped(r, documentIDs[i]); (err != nil) != (i == 0) {
+			t.Errorf("document %d: checkUnscoped() = %v", i, err)
+		}
+	}
+}
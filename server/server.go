@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptrace"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-jose/go-jose/v3"
@@ -17,6 +19,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 	tracenoop "go.opentelemetry.io/otel/trace/noop"
 
@@ -32,7 +35,18 @@ var (
 	Namespace = "github.com/topi314/gobin/v3"
 )
 
-func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, signer jose.Signer, assets http.FileSystem, htmlFormatter *html.Formatter, standaloneHTMLFormatter *html.Formatter) *Server {
+const (
+	blobMigrationBatchSize = 100
+	versionPruneBatchSize  = 100
+	trashPurgeBatchSize    = 100
+
+	// objects of the object store which no blob references are collected once a day,
+	// recent objects are kept as their blobs may not be committed yet
+	contentCollectionInterval    = 24 * time.Hour
+	contentCollectionGracePeriod = time.Hour
+)
+
+func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, snapshots database.SnapshotStore, signer jose.Signer, assets http.FileSystem, htmlFormatter *html.Formatter, standaloneHTMLFormatter *html.Formatter) *Server {
 	var allStyles []templates.Style
 	for _, name := range styles.Names() {
 		allStyles = append(allStyles, templates.Style{
@@ -63,6 +77,7 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 		debug:                   debug,
 		cfg:                     cfg,
 		db:                      db,
+		snapshots:               snapshots,
 		client:                  client,
 		signer:                  signer,
 		tracer:                  tracer,
@@ -70,6 +85,8 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 		styles:                  allStyles,
 		htmlFormatter:           htmlFormatter,
 		standaloneHTMLFormatter: standaloneHTMLFormatter,
+		// every argon2 verification needs argon2Memory, so only as many run at once as there are CPUs
+		passwordVerifications: make(chan struct{}, runtime.GOMAXPROCS(0)),
 	}
 
 	s.server = &http.Server{
@@ -87,6 +104,38 @@ func NewServer(version ver.Version, debug bool, cfg Config, db database.DB, sign
 		).Handler
 	}
 
+	// unlock attempts are always limited, so passwords can't be brute-forced
+	s.unlockLimiter = httprate.NewRateLimiter(
+		cfg.Password.Attempts,
+		time.Duration(cfg.Password.AttemptsDuration),
+		func(w http.ResponseWriter, r *http.Request) {
+			s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
+		},
+	)
+	// limits the attempts of all IPs together, so guessing from many IPs is limited too
+	s.documentUnlockLimiter = httprate.NewRateLimiter(
+		cfg.Password.DocumentAttempts,
+		time.Duration(cfg.Password.AttemptsDuration),
+		func(w http.ResponseWriter, r *http.Request) {
+			s.error(w, r, httperr.TooManyRequests(ErrRateLimit))
+		},
+	)
+
+	if snapshots != nil {
+		if _, err := otel.Meter(Name).Int64ObservableGauge("gobin.database.backup.last_success",
+			metric.WithDescription("Unix time of the last successful database backup"),
+			metric.WithUnit("s"),
+			metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+				if lastBackup := s.lastBackup.Load(); lastBackup > 0 {
+					o.Observe(lastBackup)
+				}
+				return nil
+			}),
+		); err != nil {
+			slog.Error("Error while creating backup metric", slog.Any("err", err))
+		}
+	}
+
 	return s
 }
 
@@ -95,6 +144,7 @@ type Server struct {
 	debug                   bool
 	cfg                     Config
 	db                      database.DB
+	snapshots               database.SnapshotStore
 	server                  *http.Server
 	client                  *http.Client
 	signer                  jose.Signer
@@ -104,8 +154,12 @@ type Server struct {
 	standaloneHTMLFormatter *html.Formatter
 	styles                  []templates.Style
 	rateLimitHandler        func(http.Handler) http.Handler
+	unlockLimiter           *httprate.RateLimiter
+	documentUnlockLimiter   *httprate.RateLimiter
+	passwordVerifications   chan struct{}
 	webhookWaitGroup        sync.WaitGroup
 	cleanupCancel           context.CancelFunc
+	lastBackup              atomic.Int64
 }
 
 func (s *Server) Start() {
@@ -113,6 +167,13 @@ func (s *Server) Start() {
 	s.cleanupCancel = cancel
 
 	go s.cleanup(cleanupContext, time.Duration(s.cfg.Database.CleanupInterval), time.Duration(s.cfg.Database.ExpireAfter))
+	go s.migrateBlobs(cleanupContext)
+	if s.cfg.Database.ObjectStore.Enabled {
+		go s.collectContents(cleanupContext)
+	}
+	if s.snapshots != nil {
+		go s.backup(cleanupContext, time.Duration(s.cfg.Database.Backup.Interval))
+	}
 	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		slog.Error("Error while listening", slog.Any("err", err))
 	}
@@ -160,6 +221,149 @@ func (s *Server) cleanup(ctx context.Context, cleanUpInterval time.Duration, exp
 	}
 }
 
+// backup snapshots the database every interval and deletes snapshots which are no longer retained.
+func (s *Server) backup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ctx, span := s.tracer.Start(ctx, "backup", trace.WithAttributes(
+		attribute.String("interval", interval.String()),
+		attribute.String("target", string(s.cfg.Database.Backup.Target)),
+	))
+	defer span.End()
+
+	slog.Debug("Starting database backup...")
+	snapshots, err := database.ListSnapshots(ctx, s.snapshots)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to list database backups")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to list database backups", slog.Any("err", err))
+	} else if len(snapshots) > 0 {
+		s.lastBackup.Store(snapshots[0].CreatedAt.Unix())
+	}
+
+	// don't wait for the first tick if the last backup is already due, so restarts don't delay backups
+	if err == nil && (len(snapshots) == 0 || time.Since(snapshots[0].CreatedAt) >= interval) {
+		s.doBackup(ctx)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer func() {
+		ticker.Stop()
+		slog.Debug("database backup stopped")
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.doBackup(ctx)
+		}
+	}
+}
+
+func (s *Server) doBackup(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "doBackup")
+	defer span.End()
+
+	start := time.Now()
+	snapshot, err := database.Snapshot(ctx, s.db, s.snapshots, start)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			span.SetStatus(codes.Error, "failed to backup database")
+			span.RecordError(err)
+			slog.ErrorContext(ctx, "failed to backup database", slog.Any("err", err))
+		}
+		return
+	}
+	s.lastBackup.Store(snapshot.CreatedAt.Unix())
+	slog.InfoContext(ctx, "Backed up database", slog.String("snapshot", snapshot.Name), slog.Duration("duration", time.Since(start)))
+
+	deleted, err := database.PruneSnapshots(ctx, s.snapshots, s.cfg.Database.Backup.KeepHourly, s.cfg.Database.Backup.KeepDaily)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to prune database backups")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to prune database backups", slog.Any("err", err))
+	}
+	if len(deleted) > 0 {
+		slog.InfoContext(ctx, "Pruned database backups", slog.Int("count", len(deleted)))
+	}
+}
+
+// collectContents deletes the objects of the object store which no blob references every contentCollectionInterval.
+func (s *Server) collectContents(ctx context.Context) {
+	slog.Debug("Starting object store collection...")
+	ticker := time.NewTicker(contentCollectionInterval)
+	defer func() {
+		ticker.Stop()
+		slog.Debug("object store collection stopped")
+	}()
+
+	for {
+		s.doCollectContents(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) doCollectContents(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "doCollectContents")
+	defer span.End()
+
+	count, err := s.db.DeleteUnreferencedContents(ctx, time.Now().Add(-contentCollectionGracePeriod))
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.SetStatus(codes.Error, "failed to delete unreferenced objects")
+		span.RecordError(err)
+		slog.ErrorContext(ctx, "failed to delete unreferenced objects", slog.Any("err", err))
+	}
+	if count > 0 {
+		slog.InfoContext(ctx, "Deleted unreferenced objects", slog.Int("count", count))
+	}
+}
+
+// migrateBlobs re-compresses all stored file contents which are not stored with the configured compression
+// and moves them to or from the object store depending on its configuration.
+func (s *Server) migrateBlobs(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "migrateBlobs", trace.WithAttributes(
+		attribute.String("compression", string(s.cfg.Database.Compression)),
+		attribute.Bool("object_store", s.cfg.Database.ObjectStore.Enabled),
+	))
+	defer span.End()
+
+	slog.Debug("Starting blob migration...")
+	var (
+		after string
+		total int
+	)
+	for {
+		dbCtx, dbCancel := context.WithTimeout(ctx, 10*time.Second)
+		last, count, err := s.db.MigrateBlobs(dbCtx, after, blobMigrationBatchSize)
+		dbCancel()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				span.SetStatus(codes.Error, "failed to migrate blobs")
+				span.RecordError(err)
+				slog.ErrorContext(ctx, "failed to migrate blobs", slog.Any("err", err))
+			}
+			return
+		}
+		total += count
+		if last == "" {
+			break
+		}
+		after = last
+	}
+
+	if total > 0 {
+		slog.InfoContext(ctx, "Migrated blobs", slog.Int("count", total), slog.String("compression", string(s.cfg.Database.Compression)), slog.Bool("object_store", s.cfg.Database.ObjectStore.Enabled))
+	}
+}
+
 func (s *Server) doCleanup(ctx context.Context, expireAfter time.Duration) {
 	ctx, span := s.tracer.Start(ctx, "doCleanup")
 	defer span.End()
@@ -177,21 +381,79 @@ func (s *Server) doCleanup(ctx context.Context, expireAfter time.Duration) {
 	for i := range documents {
 		wg.Add(1)
 		go func(ctx context.Context, document database.Document) {
-			webhooksFiles := make([]WebhookDocumentFile, len(document.Files))
-			for i, file := range document.Files {
-				webhooksFiles[i] = WebhookDocumentFile{
-					Name:      file.Name,
-					Content:   file.Content,
-					Language:  file.Language,
-					ExpiresAt: file.ExpiresAt,
-				}
-			}
-			s.ExecuteWebhooks(ctx, WebhookEventUpdate, WebhookDocument{
-				Key:     document.ID,
-				Version: document.Version,
-				Files:   webhooksFiles,
-			})
+			defer wg.Done()
+			s.ExecuteWebhooks(ctx, WebhookEventUpdate, newWebhookDocument(document))
 		}(ctx, documents[i])
 	}
 	wg.Wait()
+
+	s.deleteOldVersions(ctx)
+	s.deleteTrashedDocuments(ctx)
+}
+
+// deleteTrashedDocuments deletes all documents which are in the trash for longer than the delete grace period.
+func (s *Server) deleteTrashedDocuments(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "deleteTrashedDocuments")
+	defer span.End()
+
+	before := time.Now().Add(-time.Duration(s.cfg.Database.DeleteGracePeriod))
+	var total int
+	for {
+		dbCtx, dbCancel := context.WithTimeout(ctx, 10*time.Second)
+		documents, err := s.db.DeleteTrashedDocuments(dbCtx, before, trashPurgeBatchSize)
+		dbCancel()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				span.SetStatus(codes.Error, "failed to delete trashed documents")
+				span.RecordError(err)
+				slog.ErrorContext(ctx, "failed to delete trashed documents", slog.Any("err", err))
+			}
+			break
+		}
+
+		for _, document := range documents {
+			s.ExecuteWebhooks(ctx, WebhookEventDelete, newWebhookDocument(document))
+		}
+		total += len(documents)
+		if len(documents) < trashPurgeBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		slog.InfoContext(ctx, "Deleted trashed documents", slog.Int("count", total))
+	}
+}
+
+// deleteOldVersions deletes all versions which are not retained by the version retention of their document.
+func (s *Server) deleteOldVersions(ctx context.Context) {
+	ctx, span := s.tracer.Start(ctx, "deleteOldVersions")
+	defer span.End()
+
+	var total int
+	for {
+		dbCtx, dbCancel := context.WithTimeout(ctx, 10*time.Second)
+		documents, err := s.db.DeleteOldDocumentVersions(dbCtx, s.cfg.Database.KeepVersions, time.Duration(s.cfg.Database.KeepVersionsFor), versionPruneBatchSize)
+		dbCancel()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				span.SetStatus(codes.Error, "failed to delete old document versions")
+				span.RecordError(err)
+				slog.ErrorContext(ctx, "failed to delete old document versions", slog.Any("err", err))
+			}
+			break
+		}
+
+		for _, document := range documents {
+			s.ExecuteWebhooks(ctx, WebhookEventVersionDelete, newWebhookDocument(document))
+		}
+		total += len(documents)
+		if len(documents) < versionPruneBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		slog.InfoContext(ctx, "Deleted old document versions", slog.Int("count", total))
+	}
 }
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+var (
+	ErrInvalidTagName      = errors.New("invalid tag name, must be 1-64 chars of letters, digits, '.', '_' or '-', not only digits and not 'preview'")
+	ErrDocumentTagNotFound = errors.New("document tag not found")
+	tagNameRegex           = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+	reservedTagNames       = []string{"preview"}
+)
+
+type (
+	TagRequest struct {
+		Version int64 `json:"version"`
+	}
+
+	TagResponse struct {
+		Name    string `json:"name"`
+		Version int64  `json:"version"`
+	}
+)
+
+func (s *Server) GetDocumentTags(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	if err := checkUnscoped(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	if _, err := s.getLatestDocumentFiles(r, documentID); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	tags, err := s.db.GetDocumentTags(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := make([]TagResponse, len(tags))
+	for i, tag := range tags {
+		response[i] = TagResponse{
+			Name:    tag.Name,
+			Version: tag.DocumentVersion,
+		}
+	}
+	s.ok(w, r, response)
+}
+
+// PutDocumentTag creates or moves a tag to the given version or the latest version if none is given.
+func (s *Server) PutDocumentTag(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	name := chi.URLParam(r, "tag")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	if !isValidTagName(name) {
+		s.error(w, r, httperr.BadRequest(ErrInvalidTagName))
+		return
+	}
+
+	var tagRequest TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&tagRequest); err != nil && !errors.Is(err, io.EOF) {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+
+	version := tagRequest.Version
+	if version == 0 {
+		files, err := s.getLatestDocumentFiles(r, documentID)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		version = files[0].DocumentVersion
+	} else if _, err := s.db.GetDocumentVersion(r.Context(), documentID, version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentVersionNotFound))
+			return
+		}
+		s.error(w, r, fmt.Errorf("failed to get document version: %w", err))
+		return
+	}
+
+	if err := s.db.SetDocumentTag(r.Context(), documentID, name, version); err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, TagResponse{
+		Name:    name,
+		Version: version,
+	})
+}
+
+func (s *Server) DeleteDocumentTag(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	name := chi.URLParam(r, "tag")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	if err := s.db.DeleteDocumentTag(r.Context(), documentID, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentTagNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, nil)
+}
+
+// resolveVersion returns the version of a version param which is either a version number or a tag name.
+// It returns 0 for an empty param which means the latest version.
+func (s *Server) resolveVersion(r *http.Request, documentID string, versionStr string) (int64, error) {
+	if versionStr == "" {
+		return 0, nil
+	}
+	if version, err := strconv.ParseInt(versionStr, 10, 64); err == nil {
+		return version, nil
+	}
+	if !isValidTagName(versionStr) {
+		return 0, httperr.BadRequest(ErrInvalidDocumentVersion)
+	}
+
+	tag, err := s.db.GetDocumentTag(r.Context(), documentID, versionStr)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, httperr.NotFound(ErrDocumentVersionNotFound)
+		}
+		return 0, fmt.Errorf("failed to get document tag: %w", err)
+	}
+	return tag.DocumentVersion, nil
+}
+
+func isValidTagName(name string) bool {
+	return tagNameRegex.MatchString(name) && strings.Trim(name, "0123456789") != "" && !slices.Contains(reservedTagNames, name)
+}
@@ -59,7 +59,7 @@ func header(vars DocumentVars) templ.Component {
 				return templ_7745c5c3_Err
 			}
 		}
-		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "></button> <button title=\"Share\" id=\"share\" class=\"icon-btn\" disabled></button></nav></header>")
+		templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "></button> <button title=\"Share\" id=\"share\" class=\"icon-btn\" disabled></button> <button title=\"Fork\" id=\"fork\" class=\"icon-btn\" disabled></button></nav></header>")
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}
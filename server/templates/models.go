@@ -25,6 +25,10 @@ type DocumentVars struct {
 	CurrentFile int
 	TotalLength int
 	Versions    []DocumentVersion
+	NextBefore  int64
+	Compare     int64
+	ForkedFrom  *Fork
+	Private     bool
 
 	PreviewURL string
 	PreviewAlt string
@@ -51,6 +55,8 @@ type gobin struct {
 	Files       []File `json:"files"`
 	CurrentFile int    `json:"current_file"`
 	ExpireIn    int    `json:"expire_in"`
+	Compare     int64  `json:"compare"`
+	Blame       bool   `json:"blame"`
 }
 
 func (v DocumentVars) StateJSON() string {
@@ -64,6 +70,7 @@ func (v DocumentVars) StateJSON() string {
 		Mode:        mode,
 		Files:       v.Files,
 		CurrentFile: v.CurrentFile,
+		Compare:     v.Compare,
 	})
 	return fmt.Sprintf(`<script id="state" type="application/json">%s</script>`, string(data))
 }
@@ -96,6 +103,23 @@ type DocumentVersion struct {
 	Version int64
 	Label   string
 	Time    string
+	Message string
+}
+
+func (v DocumentVersion) Title() string {
+	if v.Message == "" {
+		return v.Time
+	}
+	return v.Time + "\n" + v.Message
+}
+
+type Fork struct {
+	Key     string
+	Version int64
+}
+
+func (f Fork) URL() string {
+	return fmt.Sprintf("/%s/%d", f.Key, f.Version)
 }
 
 type Style struct {
@@ -103,6 +127,12 @@ type Style struct {
 	Theme string
 }
 
+type UnlockVars struct {
+	ID       string
+	Redirect string
+	Error    string
+}
+
 type ErrorVars struct {
 	Error     string
 	Status    int
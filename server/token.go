@@ -0,0 +1,109 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+	"github.com/topi314/gobin/v3/server/database"
+)
+
+var ErrTokenNotFound = errors.New("token not found")
+
+type (
+	TokenResponse struct {
+		ID           string     `json:"id"`
+		Permissions  []string   `json:"permissions"`
+		IssuerID     *string    `json:"issuer_id"`
+		CreatedAt    time.Time  `json:"created_at"`
+		ExpiresAt    *time.Time `json:"expires_at"`
+		RevokedAt    *time.Time `json:"revoked_at"`
+		ScopeVersion *int64     `json:"scope_version,omitempty"`
+		ScopeFiles   []string   `json:"scope_files,omitempty"`
+	}
+
+	RevokeTokenResponse struct {
+		Revoked []string `json:"revoked"`
+	}
+)
+
+// GetDocumentTokens lists all tokens which have been issued for a document.
+func (s *Server) GetDocumentTokens(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionShare) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("share")))
+		return
+	}
+
+	tokens, err := s.db.GetDocumentTokens(r.Context(), documentID)
+	if err != nil {
+		s.error(w, r, err)
+		return
+	}
+
+	response := make([]TokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		tokenResponse, err := newTokenResponse(token)
+		if err != nil {
+			s.error(w, r, err)
+			return
+		}
+		response = append(response, tokenResponse)
+	}
+	s.ok(w, r, response)
+}
+
+// DeleteDocumentToken revokes a token of a document and all tokens which have been shared with it.
+func (s *Server) DeleteDocumentToken(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+	tokenID := chi.URLParam(r, "tokenID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionShare) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("share")))
+		return
+	}
+
+	revoked, err := s.db.RevokeDocumentToken(r.Context(), documentID, tokenID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrTokenNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, RevokeTokenResponse{
+		Revoked: revoked,
+	})
+}
+
+func newTokenResponse(token database.DocumentToken) (TokenResponse, error) {
+	var scopeFiles []string
+	if token.ScopeFiles != nil {
+		if err := json.Unmarshal([]byte(*token.ScopeFiles), &scopeFiles); err != nil {
+			return TokenResponse{}, fmt.Errorf("failed to decode scope files of token %s: %w", token.ID, err)
+		}
+	}
+
+	return TokenResponse{
+		ID:           token.ID,
+		Permissions:  permissionStrings(Permissions(token.Permissions)),
+		IssuerID:     token.IssuerID,
+		CreatedAt:    token.CreatedAt,
+		ExpiresAt:    token.ExpiresAt,
+		RevokedAt:    token.RevokedAt,
+		ScopeVersion: token.ScopeVersion,
+		ScopeFiles:   scopeFiles,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/topi314/gobin/v3/internal/flags"
+	"github.com/topi314/gobin/v3/internal/httperr"
+)
+
+var ErrInvalidVisibility = errors.New("invalid visibility, must be one of: public, private")
+
+type Visibility string
+
+const (
+	VisibilityPublic  Visibility = "public"
+	VisibilityPrivate Visibility = "private"
+)
+
+func (v Visibility) Valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityPrivate:
+		return true
+	default:
+		return false
+	}
+}
+
+type (
+	VisibilityRequest struct {
+		Visibility Visibility `json:"visibility"`
+	}
+
+	VisibilityResponse struct {
+		Visibility Visibility `json:"visibility"`
+	}
+)
+
+func (s *Server) GetDocumentVisibility(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	visibility, err := s.db.GetDocumentVisibility(r.Context(), documentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, VisibilityResponse{
+		Visibility: Visibility(visibility),
+	})
+}
+
+// PutDocumentVisibility makes a document public or private.
+func (s *Server) PutDocumentVisibility(w http.ResponseWriter, r *http.Request) {
+	documentID := chi.URLParam(r, "documentID")
+
+	claims := GetClaims(r)
+	if claims.Subject != documentID || flags.Misses(claims.Permissions, PermissionWrite) {
+		s.error(w, r, httperr.Forbidden(ErrPermissionDenied("write")))
+		return
+	}
+
+	var visibilityRequest VisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&visibilityRequest); err != nil {
+		s.error(w, r, httperr.BadRequest(err))
+		return
+	}
+	if !visibilityRequest.Visibility.Valid() {
+		s.error(w, r, httperr.BadRequest(ErrInvalidVisibility))
+		return
+	}
+
+	if err := s.db.SetDocumentVisibility(r.Context(), documentID, string(visibilityRequest.Visibility)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.error(w, r, httperr.NotFound(ErrDocumentNotFound))
+			return
+		}
+		s.error(w, r, err)
+		return
+	}
+
+	s.ok(w, r, VisibilityResponse{
+		Visibility: visibilityRequest.Visibility,
+	})
+}
+
+// getVisibility returns the visibility query parameter, or the fallback if it is not set.
+func getVisibility(query url.Values, fallback Visibility) (Visibility, error) {
+	if !query.Has("visibility") {
+		return fallback, nil
+	}
+	visibility := Visibility(query.Get("visibility"))
+	if !visibility.Valid() {
+		return "", httperr.BadRequest(ErrInvalidVisibility)
+	}
+	return visibility, nil
+}
@@ -64,6 +64,7 @@ type (
 	WebhookDocument struct {
 		Key     string                `json:"key"`
 		Version int64                 `json:"version"`
+		Message string                `json:"message,omitempty"`
 		Files   []WebhookDocumentFile `json:"files"`
 	}
 
@@ -76,10 +77,28 @@ type (
 )
 
 const (
-	WebhookEventUpdate string = "update"
-	WebhookEventDelete string = "delete"
+	WebhookEventUpdate        string = "update"
+	WebhookEventDelete        string = "delete"
+	WebhookEventVersionDelete string = "version_delete"
 )
 
+func newWebhookDocument(document database.Document) WebhookDocument {
+	webhooksFiles := make([]WebhookDocumentFile, len(document.Files))
+	for i, file := range document.Files {
+		webhooksFiles[i] = WebhookDocumentFile{
+			Name:      file.Name,
+			Content:   file.Content,
+			Language:  file.Language,
+			ExpiresAt: file.ExpiresAt,
+		}
+	}
+	return WebhookDocument{
+		Key:     document.ID,
+		Version: document.Version,
+		Files:   webhooksFiles,
+	}
+}
+
 func (s *Server) ExecuteWebhooks(ctx context.Context, event string, document WebhookDocument) {
 	if !s.cfg.Webhook.Enabled {
 		return